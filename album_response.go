@@ -8,4 +8,5 @@ import (
 // successful request to fetch an album resource object.
 type AlbumResponse struct {
 	Data []*library.Album `json:"data,omitempty"`
+	Meta *Meta            `json:"meta,omitempty"`
 }
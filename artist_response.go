@@ -8,4 +8,5 @@ import (
 // successful request to fetch an artist resource object.
 type ArtistResponse struct {
 	Data []*library.Artist `json:"data,omitempty"`
+	Meta *Meta             `json:"meta,omitempty"`
 }
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// The interfaces below are the context-aware counterparts of the library
+// service interfaces. To migrate a library service, add the Context variant of
+// each method and keep the original methods as wrappers that pass
+// context.Background(). The server prefers the Context variants whenever a
+// service implements them, and otherwise cannot cancel a call it abandons on
+// timeout.
+
+// GenreContextService is implemented by a library.GenreService whose work can
+// be canceled through a context, such as when a client disconnects.
+type GenreContextService interface {
+	GenresContext(ctx context.Context) ([]*library.Genre, error)
+}
+
+// AlbumContextService is implemented by a library.AlbumService whose work can
+// be canceled through a context.
+type AlbumContextService interface {
+	AlbumContext(ctx context.Context, id string) (*library.Album, error)
+	AlbumsContext(ctx context.Context, queries map[string]string) ([]*library.Album, error)
+}
+
+// ArtistContextService is implemented by a library.ArtistService whose work
+// can be canceled through a context.
+type ArtistContextService interface {
+	ArtistContext(ctx context.Context, id string) (*library.Artist, error)
+	ArtistsContext(ctx context.Context, queries map[string]string) ([]*library.Artist, error)
+}
+
+// SongContextService is implemented by a library.SongService whose work can be
+// canceled through a context.
+type SongContextService interface {
+	SongContext(ctx context.Context, id string) (*library.Song, error)
+	SongsContext(ctx context.Context, queries map[string]string) ([]*library.Song, error)
+}
+
+// SearchContextService is implemented by a SearchService whose work can be
+// canceled through a context.
+type SearchContextService interface {
+	SearchContext(ctx context.Context, term string) ([]*library.Song, []*library.Album, []*library.Artist, error)
+}
+
+// CounterContext is implemented by a Counter whose work can be canceled
+// through a context.
+type CounterContext interface {
+	CountContext(ctx context.Context, queries map[string]string) (int, error)
+}
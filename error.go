@@ -2,8 +2,17 @@ package server
 
 // Error provides custom error information.
 type Error struct {
-	Status string `json:"status,omitempty"`
-	Code   string `json:"code,omitempty"`
-	Title  string `json:"title,omitempty"`
-	Detail string `json:"detail,omitempty"`
+	Status string       `json:"status,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+	Source *ErrorSource `json:"source,omitempty"`
+}
+
+// ErrorSource identifies the part of the request that caused an error.
+// Pointer is a JSON Pointer to the offending member of the request document,
+// and Parameter names the offending query parameter.
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
 }
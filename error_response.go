@@ -1,5 +1,10 @@
 package server
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ErrorResponse provides information about problems encountered while
 // performing an operation.
 type ErrorResponse struct {
@@ -23,3 +28,53 @@ func NewStatusNotFoundError() *Error {
 		Detail: "The requested resource does not exist."}
 	return e
 }
+
+// NewBadRequestError creates an error with 400 HTTP status code.
+func NewBadRequestError(detail string) *Error {
+	e := &Error{
+		Status: "400",
+		Title:  "Bad Request",
+		Detail: detail}
+	return e
+}
+
+// NewNotAcceptableError creates an error with 406 HTTP status code for a
+// request whose Accept header lists none of the media types the resource can
+// be served as.
+func NewNotAcceptableError(detail string) *Error {
+	e := &Error{
+		Status: "406",
+		Title:  "Not Acceptable",
+		Detail: detail}
+	return e
+}
+
+// NewUnavailableForLegalReasonsError creates an error with 451 HTTP status
+// code.
+func NewUnavailableForLegalReasonsError() *Error {
+	e := &Error{
+		Status: "451",
+		Title:  "Unavailable For Legal Reasons",
+		Detail: "The requested resource is not available in your region."}
+	return e
+}
+
+// NewInvalidParameterError creates an error with 400 HTTP status code for a
+// query parameter with an invalid value.
+func NewInvalidParameterError(parameter string, detail string) *Error {
+	e := NewBadRequestError(detail)
+	e.Source = &ErrorSource{Parameter: parameter}
+	return e
+}
+
+// NewMethodNotAllowedError creates an error with 405 HTTP status code for a
+// request with the given method to a resource that only supports the allowed
+// methods.
+func NewMethodNotAllowedError(method string, allowed []string) *Error {
+	e := &Error{
+		Status: "405",
+		Title:  "Method Not Allowed",
+		Detail: fmt.Sprintf("%s is not supported; supported methods are: %s",
+			method, strings.Join(allowed, ", "))}
+	return e
+}
@@ -0,0 +1,14 @@
+package server
+
+// HALResponse represents resource data in the Hypertext Application Language
+// (HAL) format, an alternative to the default response envelope. The resources
+// are embedded under their type name, such as "songs".
+type HALResponse struct {
+	Links    map[string]HALLink     `json:"_links"`
+	Embedded map[string]interface{} `json:"_embedded,omitempty"`
+}
+
+// HALLink is a link to a resource in a HALResponse.
+type HALLink struct {
+	Href string `json:"href"`
+}
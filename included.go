@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// Included holds the resource objects related to the primary data of a
+// response that the client asked to include, so that it need not fetch them
+// one by one. Each resource object is listed once.
+//
+// It is encoded as the JSON:API "included" member, a single array of
+// resource objects each naming its type, albums before artists.
+type Included struct {
+	Albums  []*library.Album
+	Artists []*library.Artist
+}
+
+// MarshalJSON encodes the included resource objects as one array, adding to
+// each a type member of "albums" or "artists".
+func (in *Included) MarshalJSON() ([]byte, error) {
+	resources := []map[string]interface{}{}
+	add := func(typ string, v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var resource map[string]interface{}
+		if err := json.Unmarshal(b, &resource); err != nil {
+			return err
+		}
+		resource["type"] = typ
+		resources = append(resources, resource)
+		return nil
+	}
+	for _, album := range in.Albums {
+		if err := add("albums", album); err != nil {
+			return nil, err
+		}
+	}
+	for _, artist := range in.Artists {
+		if err := add("artists", artist); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(resources)
+}
+
+// SongRelationships is implemented by a library.SongService that can report
+// the IDs of the resources related to a song, which is required to include
+// them in a response. An empty ID means the song has no such resource.
+type SongRelationships interface {
+	AlbumID(song *library.Song) string
+	ArtistID(song *library.Song) string
+}
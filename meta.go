@@ -0,0 +1,17 @@
+package server
+
+// Meta provides pagination information about the collection of resource
+// objects in a response. Total is only known when the service can count the
+// matching resources, and NextOffset is absent on the last page.
+type Meta struct {
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	Total      *int `json:"total,omitempty"`
+	NextOffset *int `json:"nextOffset,omitempty"`
+}
+
+// Counter is implemented by a library service that can count the resources
+// matching the given queries without fetching them.
+type Counter interface {
+	Count(queries map[string]string) (int, error)
+}
@@ -0,0 +1,142 @@
+package artwork
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// Source provides the cover artwork of an album.
+type Source interface {
+	// Artwork returns the encoded artwork image of the given album, whose songs
+	// are given, or nil if it has none.
+	Artwork(album *library.Album, songs []*library.Song) ([]byte, error)
+}
+
+// sidecarNames lists the artwork file names SidecarSource looks for, in order
+// of preference.
+var sidecarNames = []string{"cover.jpg", "cover.jpeg", "cover.png",
+	"folder.jpg", "folder.jpeg", "folder.png", "front.jpg", "front.png"}
+
+// SidecarSource reads artwork from an image file, such as cover.jpg, stored in
+// the directory of one of the album's song files.
+type SidecarSource struct{}
+
+// Artwork reads the first sidecar artwork file found next to the album's songs.
+func (SidecarSource) Artwork(album *library.Album, songs []*library.Song) ([]byte, error) {
+	seen := make(map[string]bool)
+	for _, song := range songs {
+		if song == nil || song.Attributes == nil || song.Attributes.FilePath == "" {
+			continue
+		}
+		dir := filepath.Dir(song.Attributes.FilePath)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		for _, name := range sidecarNames {
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+// ContentType returns the media type of the encoded image, sniffed from its
+// bytes.
+func ContentType(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+// Thumbnail returns the encoded JPEG or PNG image downscaled, preserving its
+// aspect ratio, to fit within size by size pixels, in the same format. An image
+// that already fits is returned unchanged.
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("artwork: thumbnail size must be positive")
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("artwork: %w", err)
+	}
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return data, nil
+	}
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = maxInt(1, b.Dy()*size/b.Dx())
+	} else {
+		w = maxInt(1, b.Dx()*size/b.Dy())
+	}
+	thumb := downscale(img, w, h)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	case "png":
+		err = png.Encode(&buf, thumb)
+	default:
+		err = fmt.Errorf("unsupported image format %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("artwork: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale returns the image resized to w by h pixels, each pixel being the
+// average of the source pixels it covers.
+func downscale(src image.Image, w int, h int) image.Image {
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := maxInt(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := maxInt(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			// Converts the premultiplied 16-bit sums to non-premultiplied
+			// 8-bit values.
+			if a == 0 {
+				continue
+			}
+			dst.Pix[i+0] = uint8(r * 0xff / a)
+			dst.Pix[i+1] = uint8(g * 0xff / a)
+			dst.Pix[i+2] = uint8(bl * 0xff / a)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// encodeImage returns a w by h image encoded in the given format, "png" or
+// "jpeg".
+func encodeImage(t *testing.T, format string, w int, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		format string
+		w, h   int
+		size   int
+		wantW  int
+		wantH  int
+	}{
+		{"png", 400, 200, 100, 100, 50},
+		{"jpeg", 200, 400, 100, 50, 100},
+		{"png", 300, 300, 64, 64, 64},
+	}
+	for _, test := range tests {
+		thumb, err := Thumbnail(encodeImage(t, test.format, test.w, test.h), test.size)
+		if err != nil {
+			t.Fatalf("%s %dx%d: %v", test.format, test.w, test.h, err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatalf("%s %dx%d: decoding thumbnail: %v", test.format, test.w, test.h, err)
+		}
+		if format != test.format || cfg.Width != test.wantW || cfg.Height != test.wantH {
+			t.Errorf("%s %dx%d to %d: thumbnail is a %dx%d %s, want a %dx%d %s", test.format, test.w, test.h,
+				test.size, cfg.Width, cfg.Height, format, test.wantW, test.wantH, test.format)
+		}
+	}
+}
+
+func TestThumbnailFits(t *testing.T) {
+	data := encodeImage(t, "png", 32, 16)
+	thumb, err := Thumbnail(data, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(thumb, data) {
+		t.Error("an image that fits was re-encoded")
+	}
+	if _, err := Thumbnail([]byte("not an image"), 64); err == nil {
+		t.Error("Thumbnail succeeded with data that is not an image")
+	}
+	if _, err := Thumbnail(data, 0); err == nil {
+		t.Error("Thumbnail succeeded with a zero size")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	if got := ContentType(encodeImage(t, "png", 1, 1)); got != "image/png" {
+		t.Errorf("PNG content type = %q, want image/png", got)
+	}
+	if got := ContentType(encodeImage(t, "jpeg", 1, 1)); got != "image/jpeg" {
+		t.Errorf("JPEG content type = %q, want image/jpeg", got)
+	}
+}
+
+func TestSidecarSource(t *testing.T) {
+	dir := t.TempDir()
+	song := &library.Song{}
+	v := reflect.ValueOf(song).Elem().FieldByName("Attributes")
+	attrs := reflect.New(v.Type().Elem())
+	attrs.Elem().FieldByName("FilePath").SetString(filepath.Join(dir, "song.mp3"))
+	v.Set(attrs)
+	songs := []*library.Song{nil, {}, song}
+
+	data, err := SidecarSource{}.Artwork(&library.Album{}, songs)
+	if err != nil || data != nil {
+		t.Errorf("without artwork: Artwork = %q, %v, want nil", data, err)
+	}
+
+	for name, content := range map[string]string{"front.png": "front", "folder.jpg": "folder"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err = SidecarSource{}.Artwork(&library.Album{}, songs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "folder" {
+		t.Errorf("Artwork = %q, want the preferred folder.jpg", data)
+	}
+}
@@ -0,0 +1,71 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Measure returns the peak and average bitrates, in bits per second, of the
+// media segments listed by the media playlist at playlistPath, computed from
+// the size of each segment file, or of its byte range, and its EXTINF
+// duration. The peak is the highest bitrate of any single segment, as the
+// BANDWIDTH attribute of a master playlist requires.
+func Measure(playlistPath string) (peak int, average int, err error) {
+	f, err := os.Open(playlistPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(playlistPath)
+	var duration float64
+	rangeLength := int64(-1)
+	var totalBits, totalDuration float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)[0]
+			if duration, err = strconv.ParseFloat(value, 64); err != nil {
+				return 0, 0, fmt.Errorf("hls: invalid EXTINF duration %q", value)
+			}
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			value := strings.SplitN(strings.TrimPrefix(line, "#EXT-X-BYTERANGE:"), "@", 2)[0]
+			if rangeLength, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, 0, fmt.Errorf("hls: invalid byte range %q", value)
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			size := rangeLength
+			if size < 0 {
+				info, err := os.Stat(filepath.Join(dir, line))
+				if err != nil {
+					return 0, 0, err
+				}
+				size = info.Size()
+			}
+			if duration > 0 {
+				bits := float64(size * 8)
+				if rate := int(math.Ceil(bits / duration)); rate > peak {
+					peak = rate
+				}
+				totalBits += bits
+				totalDuration += duration
+			}
+			duration, rangeLength = 0, -1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if totalDuration > 0 {
+		average = int(math.Ceil(totalBits / totalDuration))
+	}
+	return peak, average, nil
+}
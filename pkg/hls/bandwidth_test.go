@@ -0,0 +1,70 @@
+package hls
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	dir := t.TempDir()
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n" +
+		"#EXTINF:10.0,\nfileSequence0.aac\n" +
+		"#EXTINF:5.0,\nfileSequence1.aac\n" +
+		"#EXTINF:4,\n#EXT-X-BYTERANGE:1000@0\nfileSequence2.aac\n" +
+		"#EXT-X-ENDLIST\n"
+	files := map[string]int{
+		"prog_index.m3u8":   0,
+		"fileSequence0.aac": 10000,
+		"fileSequence1.aac": 10000,
+		"fileSequence2.aac": 50000,
+	}
+	for name, size := range files {
+		data := []byte(strings.Repeat("x", size))
+		if name == "prog_index.m3u8" {
+			data = []byte(playlist)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peak, average, err := Measure(filepath.Join(dir, "prog_index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10000 bytes over 5 seconds is the fastest segment; the byte range, not
+	// the file size, counts for the last one.
+	if peak != 16000 {
+		t.Errorf("peak = %d, want 16000", peak)
+	}
+	// 21000 bytes over 19 seconds, rounded up.
+	if average != 8843 {
+		t.Errorf("average = %d, want 8843", average)
+	}
+}
+
+func TestMeasureMissingSegment(t *testing.T) {
+	dir := t.TempDir()
+	playlist := "#EXTM3U\n#EXTINF:10,\nfileSequence0.aac\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "prog_index.m3u8"), []byte(playlist), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Measure(filepath.Join(dir, "prog_index.m3u8")); err == nil {
+		t.Error("Measure succeeded with a missing segment")
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	got := MasterPlaylist([]Variant{
+		{Bandwidth: 70000, AverageBandwidth: 64000, URI: "64000/prog_index.m3u8"},
+		{Bandwidth: 128000, URI: "128000/prog_index.m3u8"},
+	})
+	want := "#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=70000,AVERAGE-BANDWIDTH=64000,CODECS=\"mp4a.40.2\"\n64000/prog_index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS=\"mp4a.40.2\"\n128000/prog_index.m3u8\n"
+	if got != want {
+		t.Errorf("MasterPlaylist = %q, want %q", got, want)
+	}
+}
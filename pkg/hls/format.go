@@ -0,0 +1,49 @@
+package hls
+
+import "path/filepath"
+
+// Format is the container format of generated media segments.
+type Format int
+
+const (
+	// FormatAAC produces packed AAC audio segments named fileSequenceN.aac,
+	// the format produced before formats were configurable.
+	FormatAAC Format = iota
+
+	// FormatFMP4 produces fragmented MPEG-4 (CMAF) segments named
+	// fileSequenceN.m4s, with their shared initialization section in
+	// init.mp4. Fragmented MPEG-4 has less overhead and can also be used for
+	// MPEG-DASH.
+	FormatFMP4
+)
+
+// SegmentExt returns the file name extension of media segments in the format.
+func (f Format) SegmentExt() string {
+	if f == FormatFMP4 {
+		return ".m4s"
+	}
+	return ".aac"
+}
+
+// args returns the mediafilesegmenter arguments selecting the format.
+func (f Format) args() []string {
+	if f == FormatFMP4 {
+		return []string{"-a", "-iso-fragmented"}
+	}
+	return []string{"-a"}
+}
+
+// ContentType returns the media type of the named generated file: a playlist,
+// a media segment in any format, or an initialization section. It returns an
+// empty string for other files.
+func ContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/x-mpegURL"
+	case ".aac":
+		return "audio/aac"
+	case ".m4s", ".mp4":
+		return "audio/mp4"
+	}
+	return ""
+}
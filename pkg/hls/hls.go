@@ -1,18 +1,66 @@
 package hls
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"strconv"
+	"time"
 )
 
+// Segmenter splits a media file into the index (playlist) file and media
+// segment files used for HTTP Live Streaming.
+type Segmenter interface {
+	// Segment writes the playlist and segments for the media file at songPath
+	// into the directory destPath. It stops and returns an error when ctx is
+	// canceled.
+	Segment(ctx context.Context, songPath string, destPath string) error
+}
+
+// MediaFileSegmenter is a Segmenter backed by Apple's mediafilesegmenter
+// command-line tool.
+type MediaFileSegmenter struct {
+	// TargetDuration is the target duration of each media segment. Shorter
+	// segments allow finer seeking at the cost of more requests. Zero uses the
+	// tool's default of 10 seconds.
+	TargetDuration time.Duration
+
+	// Format is the container format of the media segments. Defaults to
+	// FormatAAC.
+	Format Format
+}
+
 // Segment runs the mediafilesegmenter command-line tool. This tool takes a
-// media file as an input, wraps it in an MPEG-2 transport stream, and produces
-// a series of equal-length files from it, suitable for use in HTTP Live
-// Streaming. It also produces an produce an index (playlist) file.
-func Segment(songPath string, destPath string) error {
-	cmd := exec.Command("mediafilesegmenter", "-a", "-f", destPath, songPath)
+// media file as an input, wraps it in the configured segment format, and
+// produces a series of equal-length files from it, suitable for use in HTTP
+// Live Streaming. It also produces an index (playlist) file. When the tool is
+// not installed, the returned error wraps exec.ErrNotFound. The tool is
+// killed when ctx is canceled, and the returned error then wraps the context's
+// error.
+func (s MediaFileSegmenter) Segment(ctx context.Context, songPath string, destPath string) error {
+	if s.TargetDuration < 0 {
+		return errors.New("mediafilesegmenter: target duration must be positive")
+	}
+	args := append(s.Format.args(), "-f", destPath)
+	if s.TargetDuration > 0 {
+		t := strconv.FormatFloat(s.TargetDuration.Seconds(), 'f', -1, 64)
+		args = append(args, "-t", t)
+	}
+	args = append(args, songPath)
+	cmd := exec.CommandContext(ctx, "mediafilesegmenter", args...)
 	err := cmd.Run()
-	if err != nil {
-		return err
+	if ctx.Err() != nil {
+		return fmt.Errorf("mediafilesegmenter: %w", ctx.Err())
+	} else if err != nil {
+		return fmt.Errorf("mediafilesegmenter: %w", err)
 	}
 	return nil
 }
+
+// Segment segments the media file at songPath into destPath using the
+// mediafilesegmenter command-line tool, with segments of the given target
+// duration. A zero duration uses the tool's default.
+func Segment(ctx context.Context, songPath string, destPath string, targetDuration time.Duration) error {
+	return MediaFileSegmenter{TargetDuration: targetDuration}.Segment(ctx, songPath, destPath)
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package hls
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegmentArgs(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	tool := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "mediafilesegmenter"), []byte(tool), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		segmenter MediaFileSegmenter
+		want      string
+	}{
+		{MediaFileSegmenter{}, "-a -f out song.mp3"},
+		{MediaFileSegmenter{Format: FormatAAC, TargetDuration: 6 * time.Second}, "-a -f out -t 6 song.mp3"},
+		{MediaFileSegmenter{Format: FormatFMP4}, "-a -iso-fragmented -f out song.mp3"},
+		{MediaFileSegmenter{Format: FormatFMP4, TargetDuration: 1500 * time.Millisecond}, "-a -iso-fragmented -f out -t 1.5 song.mp3"},
+	}
+	for _, test := range tests {
+		if err := test.segmenter.Segment(context.Background(), "song.mp3", "out"); err != nil {
+			t.Fatalf("%+v: %v", test.segmenter, err)
+		}
+		b, err := ioutil.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(b)); got != test.want {
+			t.Errorf("%+v: arguments = %q, want %q", test.segmenter, got, test.want)
+		}
+	}
+}
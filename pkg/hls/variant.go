@@ -0,0 +1,71 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VariantSegmenter is a Segmenter that can also re-encode a media file at a
+// given bitrate before segmenting it, to produce the variant streams of an
+// adaptive-bitrate master playlist.
+type VariantSegmenter interface {
+	Segmenter
+
+	// SegmentVariant writes the playlist and segments for the media file at
+	// songPath, re-encoded at the given bitrate in bits per second, into the
+	// directory destPath.
+	SegmentVariant(ctx context.Context, songPath string, destPath string, bitrate int) error
+}
+
+// SegmentVariant re-encodes the media file as AAC at the given bitrate with
+// Apple's afconvert command-line tool, then segments the result with
+// mediafilesegmenter. The intermediate file is removed afterwards.
+func (s MediaFileSegmenter) SegmentVariant(ctx context.Context, songPath string,
+	destPath string, bitrate int) error {
+	if bitrate <= 0 {
+		return fmt.Errorf("afconvert: bitrate must be positive")
+	}
+	encoded := filepath.Join(destPath, "source.m4a")
+	defer os.Remove(encoded)
+	cmd := exec.CommandContext(ctx, "afconvert",
+		"-f", "m4af", "-d", "aac", "-b", strconv.Itoa(bitrate), songPath, encoded)
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("afconvert: %w", ctx.Err())
+	} else if err != nil {
+		return fmt.Errorf("afconvert: %w", err)
+	}
+	return s.Segment(ctx, encoded, destPath)
+}
+
+// Variant describes a variant stream referenced by a master playlist.
+type Variant struct {
+	// Bandwidth is the peak bitrate of the variant in bits per second.
+	Bandwidth int
+	// AverageBandwidth is the average bitrate of the variant in bits per
+	// second. It is omitted from the master playlist when zero.
+	AverageBandwidth int
+	// URI is the location of the variant's playlist, relative to the master
+	// playlist.
+	URI string
+}
+
+// MasterPlaylist returns a master playlist that lets clients choose among the
+// given AAC audio variant streams.
+func MasterPlaylist(variants []Variant) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, v := range variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", v.Bandwidth)
+		if v.AverageBandwidth > 0 {
+			fmt.Fprintf(&b, ",AVERAGE-BANDWIDTH=%d", v.AverageBandwidth)
+		}
+		fmt.Fprintf(&b, ",CODECS=\"mp4a.40.2\"\n%s\n", v.URI)
+	}
+	return b.String()
+}
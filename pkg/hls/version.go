@@ -0,0 +1,81 @@
+package hls
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	versionTag    = regexp.MustCompile(`(?m)^#EXT-X-VERSION:(\d+)\s*$`)
+	decimalExtinf = regexp.MustCompile(`(?m)^#EXTINF:\d*\.\d+`)
+	keyWithIV     = regexp.MustCompile(`(?m)^#EXT-X-KEY:.*\bIV=`)
+	keyFormat     = regexp.MustCompile(`(?m)^#EXT-X-KEY:.*\b(KEYFORMAT|KEYFORMATVERSIONS)=`)
+)
+
+// MinVersion returns the lowest protocol version, as given by an
+// EXT-X-VERSION tag, that a playlist using the tags in the given playlist must
+// declare.
+func MinVersion(playlist string) int {
+	hasTag := func(tag string) bool {
+		return strings.Contains(playlist, "\n"+tag) || strings.HasPrefix(playlist, tag)
+	}
+	switch {
+	case hasTag("#EXT-X-MAP"):
+		// Fragmented MPEG-4 segments require version 7.
+		return 7
+	case keyFormat.MatchString(playlist):
+		return 5
+	case hasTag("#EXT-X-BYTERANGE"), hasTag("#EXT-X-I-FRAMES-ONLY"):
+		return 4
+	case decimalExtinf.MatchString(playlist):
+		return 3
+	case keyWithIV.MatchString(playlist):
+		return 2
+	}
+	return 1
+}
+
+// SetVersion returns the playlist with its EXT-X-VERSION tag raised to the
+// version required by its tags. A higher declared version is never lowered,
+// and no tag is added to a playlist that only needs version 1.
+func SetVersion(playlist string) string {
+	min := MinVersion(playlist)
+	if m := versionTag.FindStringSubmatch(playlist); m != nil {
+		if v, err := strconv.Atoi(m[1]); err == nil && v >= min {
+			return playlist
+		}
+		return versionTag.ReplaceAllString(playlist, "#EXT-X-VERSION:"+strconv.Itoa(min))
+	}
+	if min == 1 {
+		return playlist
+	}
+	tag := "#EXT-X-VERSION:" + strconv.Itoa(min)
+	if strings.HasPrefix(playlist, "#EXTM3U") {
+		i := strings.Index(playlist, "\n")
+		if i < 0 {
+			return playlist + "\n" + tag + "\n"
+		}
+		return playlist[:i+1] + tag + "\n" + playlist[i+1:]
+	}
+	return tag + "\n" + playlist
+}
+
+// SetFileVersion rewrites the playlist file at path with SetVersion.
+func SetFileVersion(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	playlist := SetVersion(string(b))
+	if playlist == string(b) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(playlist), info.Mode())
+}
@@ -0,0 +1,83 @@
+package hls
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMinVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     int
+	}{
+		{"fragmented MPEG-4", "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:10.0,\nfileSequence0.m4s\n", 7},
+		{"key format", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",KEYFORMAT=\"identity\"\n", 5},
+		{"byte range", "#EXTM3U\n#EXTINF:10,\n#EXT-X-BYTERANGE:1000@0\nmedia.aac\n", 4},
+		{"decimal duration", "#EXTM3U\n#EXTINF:9.975,\nfileSequence0.aac\n", 3},
+		{"key with IV", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x1\n#EXTINF:10,\na.aac\n", 2},
+		{"integer duration", "#EXTM3U\n#EXTINF:10,\nfileSequence0.aac\n", 1},
+	}
+	for _, test := range tests {
+		if got := MinVersion(test.playlist); got != test.want {
+			t.Errorf("%s: MinVersion = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSetVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{
+			"inserted after the header",
+			"#EXTM3U\n#EXTINF:9.5,\na.aac\n",
+			"#EXTM3U\n#EXT-X-VERSION:3\n#EXTINF:9.5,\na.aac\n",
+		},
+		{
+			"raised",
+			"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-MAP:URI=\"init.mp4\"\n",
+			"#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-MAP:URI=\"init.mp4\"\n",
+		},
+		{
+			"higher version kept",
+			"#EXTM3U\n#EXT-X-VERSION:6\n#EXTINF:9.5,\na.aac\n",
+			"#EXTM3U\n#EXT-X-VERSION:6\n#EXTINF:9.5,\na.aac\n",
+		},
+		{
+			"version 1 not declared",
+			"#EXTM3U\n#EXTINF:10,\na.aac\n",
+			"#EXTM3U\n#EXTINF:10,\na.aac\n",
+		},
+		{
+			"header without line break",
+			"#EXTM3U",
+			"#EXTM3U",
+		},
+	}
+	for _, test := range tests {
+		if got := SetVersion(test.playlist); got != test.want {
+			t.Errorf("%s: SetVersion = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSetFileVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog_index.m3u8")
+	if err := ioutil.WriteFile(path, []byte("#EXTM3U\n#EXT-X-BYTERANGE:10@0\na.aac\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetFileVersion(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#EXTM3U\n#EXT-X-VERSION:4\n#EXT-X-BYTERANGE:10@0\na.aac\n"; string(b) != want {
+		t.Errorf("playlist = %q, want %q", b, want)
+	}
+}
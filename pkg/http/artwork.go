@@ -0,0 +1,106 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jeremybouzigard/server/pkg/artwork"
+)
+
+// maxArtworkSize is the largest thumbnail size, in pixels, a client may request.
+const maxArtworkSize = 2048
+
+// artworkDir is the subdirectory of the temporary directory that caches
+// artwork thumbnails. The janitor treats it like a song's directory, so that
+// thumbnails not served for SegmentTTL are removed; a thumbnail removed is
+// generated again when next requested.
+const artworkDir = "artwork"
+
+// handleGetAlbumArtwork handles a request to get the cover artwork of the album
+// with the given ID. The optional size query parameter requests a thumbnail
+// downscaled to fit within size by size pixels, which is cached once
+// generated.
+func (h *Handler) handleGetAlbumArtwork(w http.ResponseWriter, r *http.Request) {
+	size, e := parseInt(r.URL.Query(), "size", 0, 1, maxArtworkSize)
+	if e != nil {
+		writeError(w, http.StatusBadRequest, e)
+		return
+	}
+	albumID := mux.Vars(r)["id"]
+	album, err := h.album(r.Context(), albumID)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	} else if album == nil || h.ArtworkSource == nil {
+		handleNotFound(w, r)
+		return
+	}
+	songs, err := h.songs(r.Context(), map[string]string{"albumID": albumID})
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	data, err := h.ArtworkSource.Artwork(album, songs)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	} else if len(data) == 0 {
+		handleNotFound(w, r)
+		return
+	}
+	if size > 0 {
+		if data, err = h.thumbnail(albumID, data, size); err != nil {
+			handleError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", artwork.ContentType(data))
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", sum[:16]))
+	if h.CacheMaxAge > 0 {
+		maxAge := strconv.Itoa(int(h.CacheMaxAge.Seconds()))
+		w.Header().Set("Cache-Control", "public, max-age="+maxAge)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// thumbnail returns the given artwork of the given album downscaled to the
+// given size, from the cache when it was generated before from the same
+// artwork. A cached thumbnail is named after a digest of the artwork it was
+// generated from, so that a changed artwork image replaces it. Thumbnails of
+// different albums or sizes are generated concurrently.
+func (h *Handler) thumbnail(albumID string, data []byte, size int) ([]byte, error) {
+	base := fmt.Sprintf("%s-%d", albumID, size)
+	unlock := h.songLocks.lock(filepath.Join(artworkDir, base))
+	defer unlock()
+	h.songAccess.touch(artworkDir)
+
+	dir := filepath.Join(h.TempDir, artworkDir)
+	sum := sha256.Sum256(data)
+	name := filepath.Join(dir, fmt.Sprintf("%s-%x", base, sum[:8]))
+	if b, err := ioutil.ReadFile(name); err == nil {
+		return b, nil
+	}
+	thumb, err := artwork.Thumbnail(data, size)
+	if err != nil {
+		return nil, err
+	}
+	// Removes thumbnails of a previous artwork image.
+	removeFiles(dir, []string{base + "-*"})
+	h.mkdir(dir)
+	if err := ioutil.WriteFile(name, thumb, 0600); err != nil {
+		h.log().Error("artwork cache", "error", err)
+	} else if h.FileMode != 0 {
+		os.Chmod(name, h.FileMode)
+	}
+	return thumb, nil
+}
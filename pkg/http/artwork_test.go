@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeImage writes a blank w by h image encoded in the format of the file
+// name's extension to the named file.
+func writeImage(t *testing.T, name string, w int, h int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	var buf bytes.Buffer
+	var err error
+	if filepath.Ext(name) == ".png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetAlbumArtwork(t *testing.T) {
+	h, media := newTestHandler(t)
+
+	w := serve(h, "GET", "/albums/7/artwork", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("without artwork: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "404" {
+		t.Errorf("without artwork: errors = %+v, want one 404 error", errs)
+	}
+	if w := serve(h, "GET", "/albums/99/artwork", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing album: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	for _, name := range []string{"cover.png", "cover.jpg"} {
+		os.Remove(filepath.Join(media, "cover.png"))
+		data := writeImage(t, filepath.Join(media, name), 8, 8)
+		w := serve(h, "GET", "/albums/7/artwork", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", name, w.Code, http.StatusOK)
+		}
+		want := "image/png"
+		if name == "cover.jpg" {
+			want = "image/jpeg"
+		}
+		if ct := w.Header().Get("Content-Type"); ct != want {
+			t.Errorf("%s: Content-Type = %q, want %q", name, ct, want)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("%s: body is not the artwork file", name)
+		}
+	}
+}
+
+func TestGetAlbumArtworkSize(t *testing.T) {
+	h, media := newTestHandler(t)
+	writeImage(t, filepath.Join(media, "cover.png"), 200, 100)
+
+	for _, size := range []string{"0", "2049", "abc"} {
+		w := serve(h, "GET", "/albums/7/artwork?size="+size, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("size=%s: status = %d, want %d", size, w.Code, http.StatusBadRequest)
+			continue
+		}
+		if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != "size" {
+			t.Errorf("size=%s: errors = %+v, want one error for parameter size", size, errs)
+		}
+	}
+
+	thumbnailWidth := func() int {
+		t.Helper()
+		w := serve(h, "GET", "/albums/7/artwork?size=50", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		cfg, err := png.DecodeConfig(w.Body)
+		if err != nil {
+			t.Fatalf("decoding thumbnail: %v", err)
+		}
+		return cfg.Width
+	}
+	if width := thumbnailWidth(); width != 50 {
+		t.Errorf("thumbnail width = %d, want 50", width)
+	}
+	if width := thumbnailWidth(); width != 50 {
+		t.Errorf("cached thumbnail width = %d, want 50", width)
+	}
+
+	// A changed artwork image replaces the cached thumbnail.
+	writeImage(t, filepath.Join(media, "cover.png"), 100, 200)
+	if width := thumbnailWidth(); width != 25 {
+		t.Errorf("thumbnail width after the artwork changed = %d, want 25", width)
+	}
+	cached, _ := filepath.Glob(filepath.Join(h.TempDir, artworkDir, "7-50-*"))
+	if len(cached) != 1 {
+		t.Errorf("cached thumbnails = %v, want one", cached)
+	}
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+)
+
+// compressedTypes lists the response media types compressed by compressJSON.
+// Media segments and playlists are not listed: segments are already
+// compressed and playlists are small, or precompressed when configured.
+var compressedTypes = map[string]bool{
+	"application/json":     true,
+	"application/hal+json": true,
+}
+
+// gzipResponseWriter compresses the response body with gzip when the response
+// turns out to be JSON.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	accepted    bool
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+// WriteHeader decides from the response headers whether to compress the body,
+// then writes the header.
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if compressedTypes[mediaType] {
+		addVary(h, "Accept-Encoding")
+		if g.accepted && h.Get("Content-Encoding") == "" &&
+			code != http.StatusNoContent && code != http.StatusNotModified {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			g.gz = gzip.NewWriter(g.ResponseWriter)
+		}
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes b to the response, compressed when so decided.
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped response writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close flushes any compressed data to the response.
+func (g *gzipResponseWriter) close() error {
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	return nil
+}
+
+// compressJSON is middleware that compresses JSON responses with gzip for
+// clients that accept it.
+func (h *Handler) compressJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := &gzipResponseWriter{ResponseWriter: w, accepted: acceptsEncoding(r, "gzip")}
+		next.ServeHTTP(g, r)
+		if err := g.close(); err != nil {
+			h.log().Error("gzip", "path", r.URL.Path, "error", err)
+		}
+	})
+}
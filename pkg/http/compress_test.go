@@ -0,0 +1,47 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/jeremybouzigard/server"
+)
+
+func TestCompressJSON(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	plain := serve(h, "GET", "/songs/5", nil)
+	if enc := plain.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("without Accept-Encoding: Content-Encoding = %q, want none", enc)
+	}
+
+	w := serve(h, "GET", "/songs/5", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", enc)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Errorf("decompressed body = %q, want %q", body, plain.Body.Bytes())
+	}
+	var response server.SongResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("decoding song response: %v", err)
+	}
+	if len(response.Data) != 1 {
+		t.Errorf("songs = %d, want 1", len(response.Data))
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsAllowedHeaders lists the request headers a cross-origin client may send.
+const corsAllowedHeaders = "Accept, Accept-Encoding, Range, Want-Digest"
+
+// corsExposedHeaders lists the response headers a cross-origin client may read
+// in addition to the CORS-safelisted ones.
+const corsExposedHeaders = "Content-Disposition, Content-Length, Content-Range, Accept-Ranges, Digest, ETag, X-Total-Count"
+
+// cors is middleware that allows browsers on the AllowedOrigins to call the
+// API, and that answers OPTIONS requests, including CORS preflight requests,
+// to any route with a 204 and an Allow header listing the route's methods.
+func (h *Handler) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every response depends on the Origin once origins are allowed, as
+		// only responses to allowed ones carry the CORS headers.
+		if len(h.AllowedOrigins) > 0 {
+			addVary(w.Header(), "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		if origin != "" && h.allowedOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+		route := mux.CurrentRoute(r)
+		if r.Method != http.MethodOptions || route == nil || route.GetName() == notFoundRoute {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Answers with the methods of the matched route.
+		methods, err := route.GetMethods()
+		if err == nil {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			if err == nil {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			}
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedOrigin reports whether the given origin is one of the AllowedOrigins.
+func (h *Handler) allowedOrigin(origin string) bool {
+	for _, allowed := range h.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.AllowedOrigins = []string{"https://example.com"}
+
+	w := serve(h, "OPTIONS", "/songs/5", map[string]string{
+		"Origin":                        "https://example.com",
+		"Access-Control-Request-Method": "GET",
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want https://example.com", got)
+	}
+	if got, want := w.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != corsAllowedHeaders {
+		t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, corsAllowedHeaders)
+	}
+
+	w = serve(h, "OPTIONS", "/songs/5", map[string]string{"Origin": "https://other.example.com"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("disallowed origin: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin: Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
+
+func TestCORSOnInvalidID(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.AllowedOrigins = []string{"https://example.com"}
+
+	w := serve(h, "GET", "/songs/12345678901234567890", map[string]string{"Origin": "https://example.com"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want https://example.com", got)
+	}
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+)
+
+// digestWriter computes the SHA-256 digest of the response body as it is
+// written, so that it covers exactly the bytes sent to the client, including
+// when only a range of the file is sent.
+type digestWriter struct {
+	http.ResponseWriter
+	hash        hash.Hash
+	status      int
+	wroteHeader bool
+}
+
+// newDigestWriter returns a digestWriter that declares the Digest trailer on w.
+func newDigestWriter(w http.ResponseWriter) *digestWriter {
+	w.Header().Set("Trailer", "Digest")
+	return &digestWriter{ResponseWriter: w, hash: sha256.New(), status: http.StatusOK}
+}
+
+// WriteHeader records the status code before writing it. A successful
+// response is sent without a Content-Length so that it is chunked: the server
+// drops trailers from responses of a declared length.
+func (d *digestWriter) WriteHeader(code int) {
+	if d.wroteHeader {
+		return
+	}
+	d.wroteHeader = true
+	d.status = code
+	if code == http.StatusOK || code == http.StatusPartialContent {
+		d.Header().Del("Content-Length")
+	}
+	d.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes b to the response and adds the written bytes to the digest.
+func (d *digestWriter) Write(b []byte) (int, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	n, err := d.ResponseWriter.Write(b)
+	d.hash.Write(b[:n])
+	return n, err
+}
+
+// Unwrap returns the wrapped response writer.
+func (d *digestWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// setTrailer sets the Digest trailer for a successful response. It must be
+// called after the body has been written.
+func (d *digestWriter) setTrailer() {
+	if d.status == http.StatusOK || d.status == http.StatusPartialContent {
+		sum := base64.StdEncoding.EncodeToString(d.hash.Sum(nil))
+		d.Header().Set("Digest", "sha-256="+sum)
+	}
+}
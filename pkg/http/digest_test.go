@@ -0,0 +1,52 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSegmentDigestTrailer(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	tests := []struct {
+		rangeHeader string
+		body        []byte
+	}{
+		{"", segmentBody},
+		{"bytes=2-5", segmentBody[2:6]},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", srv.URL+"/songs/5/fileSequence0.aac", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Want-Digest", "sha-256")
+		if test.rangeHeader != "" {
+			req.Header.Set("Range", test.rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != string(test.body) {
+			t.Errorf("Range %q: body = %q, want %q", test.rangeHeader, body, test.body)
+		}
+		sum := sha256.Sum256(test.body)
+		want := "sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+		if got := resp.Trailer.Get("Digest"); got != want {
+			t.Errorf("Range %q: Digest trailer = %q, want %q", test.rangeHeader, got, want)
+		}
+	}
+}
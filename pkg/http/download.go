@@ -0,0 +1,66 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+)
+
+// handleGetDownload handles a request to download the original file of the
+// song with the given ID as an attachment. Byte-range requests are supported
+// so that interrupted downloads can be resumed.
+func (h *Handler) handleGetDownload(w http.ResponseWriter, r *http.Request) {
+	song, err := h.song(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	} else if song == nil || song.Attributes == nil {
+		handleNotFound(w, r)
+		return
+	}
+	h.serveOriginal(w, r, song.Attributes.FilePath, true)
+}
+
+// serveOriginal serves the original song file at the given path, as an
+// attachment when attachment is true. The file must lie within MediaRoot; a
+// file outside it or missing, or any file when MediaRoot is unset, is answered
+// with a 404.
+func (h *Handler) serveOriginal(w http.ResponseWriter, r *http.Request,
+	path string, attachment bool) {
+	if path == "" || h.MediaRoot == "" || !withinDir(h.MediaRoot, path) {
+		handleNotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		handleNotFound(w, r)
+		return
+	} else if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	} else if info.IsDir() {
+		handleNotFound(w, r)
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if attachment {
+		disposition := mime.FormatMediaType("attachment",
+			map[string]string{"filename": filepath.Base(path)})
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
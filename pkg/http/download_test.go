@@ -0,0 +1,66 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	h, _ := newTestHandler(t)
+	outside := filepath.Join(t.TempDir(), "secret.mp3")
+	if err := ioutil.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h.SongService.(*songService).songs["6"] = newSong(outside)
+
+	w := serve(h, "GET", "/songs/5/download", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), "attachment; filename=song.mp3"; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	if got := w.Body.String(); got != "ID3 song data" {
+		t.Errorf("body = %q, want the song file", got)
+	}
+
+	if w := serve(h, "GET", "/songs/6/download", nil); w.Code != http.StatusNotFound {
+		t.Errorf("file outside MediaRoot: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	h.CountryResolver = countryResolver("XX")
+	h.BlockedCountries = []string{"XX"}
+	if w := serve(h, "GET", "/songs/5/download", nil); w.Code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("blocked region: status = %d, want %d", w.Code, http.StatusUnavailableForLegalReasons)
+	}
+}
+
+func TestOriginalsRequireMediaRoot(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.MediaRoot = ""
+
+	if w := serve(h, "GET", "/songs/5/download", nil); w.Code != http.StatusNotFound {
+		t.Errorf("download: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w := serve(h, "GET", "/songs/5/stream", map[string]string{"Accept": "audio/mpeg"})
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("audio stream: status = %d, want %d", w.Code, http.StatusNotAcceptable)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "406" {
+		t.Errorf("audio stream: errors = %+v, want one 406 error", errs)
+	}
+	if strings.Contains(w.Body.String(), "ID3 song data") {
+		t.Error("audio stream: served the original file")
+	}
+
+	w = serve(h, "GET", "/songs/5/stream", map[string]string{"Accept": "application/x-mpegURL, audio/mpeg;q=0.5"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("HLS stream: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-mpegURL" {
+		t.Errorf("HLS stream: Content-Type = %q, want application/x-mpegURL", ct)
+	}
+}
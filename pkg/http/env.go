@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"os"
+)
+
+// Environment variables read by NewHandlerFromEnv.
+const (
+	envAddr     = "SERVER_ADDR"
+	envTempRoot = "SERVER_TMPDIR"
+	envCertFile = "SERVER_TLS_CERT"
+	envKeyFile  = "SERVER_TLS_KEY"
+	envLogLevel = "SERVER_LOG_LEVEL"
+)
+
+// NewHandlerFromEnv returns a new instance of a Handler configured from the
+// environment, for deployments that cannot change the code, such as
+// containers:
+//
+//	SERVER_ADDR       the address to listen on, such as ":8080"
+//	SERVER_TMPDIR     the directory to create the temporary directory in
+//	SERVER_TLS_CERT   the TLS certificate file; requires SERVER_TLS_KEY
+//	SERVER_TLS_KEY    the TLS private key file; requires SERVER_TLS_CERT
+//	SERVER_LOG_LEVEL  "info" to log every request, or "error" to log failures
+//
+// Unset variables keep the defaults of NewHandler, and an invalid value is
+// reported as an error. Fields set on the returned Handler override the
+// environment.
+func NewHandlerFromEnv() (*Handler, error) {
+	h := NewHandler()
+	if addr := os.Getenv(envAddr); addr != "" {
+		if err := validateAddr(addr); err != nil {
+			return nil, fmt.Errorf("%s: %v", envAddr, err)
+		}
+		h.Addr = addr
+	}
+	if root := os.Getenv(envTempRoot); root != "" {
+		if info, err := os.Stat(root); err != nil {
+			return nil, fmt.Errorf("%s: %v", envTempRoot, err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("%s: %s is not a directory", envTempRoot, root)
+		}
+		h.TempRoot = root
+	}
+
+	certFile, keyFile := os.Getenv(envCertFile), os.Getenv(envKeyFile)
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%s and %s must be set together", envCertFile, envKeyFile)
+	}
+	if certFile != "" {
+		if _, err := os.Stat(certFile); err != nil {
+			return nil, fmt.Errorf("%s: %v", envCertFile, err)
+		}
+		if _, err := os.Stat(keyFile); err != nil {
+			return nil, fmt.Errorf("%s: %v", envKeyFile, err)
+		}
+	}
+	h.CertFile, h.KeyFile = certFile, keyFile
+
+	if level := os.Getenv(envLogLevel); level != "" {
+		if level != logLevelInfo && level != logLevelError {
+			return nil, fmt.Errorf("%s: %q is not a log level; log levels are: %s, %s",
+				envLogLevel, level, logLevelInfo, logLevelError)
+		}
+		h.LogLevel = level
+	}
+	return h, nil
+}
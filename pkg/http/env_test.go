@@ -0,0 +1,76 @@
+package http
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewHandlerFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	for _, name := range []string{cert, key} {
+		if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(envAddr, "localhost:9090")
+	t.Setenv(envTempRoot, dir)
+	t.Setenv(envCertFile, cert)
+	t.Setenv(envKeyFile, key)
+	t.Setenv(envLogLevel, logLevelError)
+
+	h, err := NewHandlerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Addr != "localhost:9090" || h.TempRoot != dir || h.CertFile != cert || h.KeyFile != key || h.LogLevel != logLevelError {
+		t.Errorf("handler = Addr %q, TempRoot %q, CertFile %q, KeyFile %q, LogLevel %q, want the environment",
+			h.Addr, h.TempRoot, h.CertFile, h.KeyFile, h.LogLevel)
+	}
+	if err := h.RegisterRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(h.TempDir)
+	if filepath.Dir(h.TempDir) != dir {
+		t.Errorf("TempDir = %q, want a directory in %q", h.TempDir, dir)
+	}
+}
+
+func TestNewHandlerFromEnvInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(cert, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		variable string
+	}{
+		{"bad address", map[string]string{envAddr: "localhost"}, envAddr},
+		{"missing temporary directory", map[string]string{envTempRoot: filepath.Join(dir, "missing")}, envTempRoot},
+		{"file as temporary directory", map[string]string{envTempRoot: cert}, envTempRoot},
+		{"certificate without key", map[string]string{envCertFile: cert}, envKeyFile},
+		{"missing key file", map[string]string{envCertFile: cert, envKeyFile: filepath.Join(dir, "missing")}, envKeyFile},
+		{"unknown log level", map[string]string{envLogLevel: "debug"}, envLogLevel},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{envAddr, envTempRoot, envCertFile, envKeyFile, envLogLevel} {
+				t.Setenv(name, test.env[name])
+			}
+			h, err := NewHandlerFromEnv()
+			if err == nil {
+				t.Fatalf("handler = %+v, want an error", h)
+			}
+			if !strings.Contains(err.Error(), test.variable) {
+				t.Errorf("error = %q, want it to name %s", err, test.variable)
+			}
+		})
+	}
+}
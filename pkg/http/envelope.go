@@ -0,0 +1,66 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/jeremybouzigard/server"
+)
+
+// formats lists the alternative response envelopes that a client can request
+// through the Accept header, keyed by media type. Responses are sent in the
+// default envelope of the server package when none of them is accepted.
+var formats = []struct {
+	mediaType string
+	envelope  func(r *http.Request, v interface{}) interface{}
+}{
+	{"application/hal+json", halEnvelope},
+}
+
+// encodeResponse writes the response in the envelope negotiated with the
+// client.
+func encodeResponse(w http.ResponseWriter, r *http.Request, v interface{}) {
+	addVary(w.Header(), "Accept")
+	for _, f := range formats {
+		if accepts(r, f.mediaType) {
+			encodeJSON(w, r, f.mediaType, f.envelope(r, v))
+			return
+		}
+	}
+	encodeJSON(w, r, "application/json", v)
+}
+
+// halEnvelope wraps the data of the response in a HAL document that links to
+// the requested resource.
+func halEnvelope(r *http.Request, v interface{}) interface{} {
+	return server.HALResponse{
+		Links:    map[string]server.HALLink{"self": {Href: r.URL.RequestURI()}},
+		Embedded: resources(v)}
+}
+
+// resources returns the primary data of a response keyed by resource type
+// name.
+func resources(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case server.AlbumResponse:
+		return map[string]interface{}{"albums": v.Data}
+	case server.ArtistResponse:
+		return map[string]interface{}{"artists": v.Data}
+	case server.GenreResponse:
+		return map[string]interface{}{"genres": v.Data}
+	case server.SongResponse:
+		embedded := map[string]interface{}{"songs": v.Data}
+		if v.Included != nil {
+			embedded["albums"] = v.Included.Albums
+			embedded["artists"] = v.Included.Artists
+		}
+		return embedded
+	case server.SchemaResponse:
+		return map[string]interface{}{"parameters": v.Data}
+	case server.SearchResponse:
+		return map[string]interface{}{
+			"songs":   v.Songs,
+			"albums":  v.Albums,
+			"artists": v.Artists}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHALSongResponse(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "GET", "/songs/5", map[string]string{"Accept": "application/hal+json"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/hal+json" {
+		t.Errorf("Content-Type = %q, want application/hal+json", ct)
+	}
+	var doc struct {
+		Links    map[string]struct{ Href string } `json:"_links"`
+		Embedded map[string]json.RawMessage       `json:"_embedded"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decoding HAL response %q: %v", w.Body.String(), err)
+	}
+	if href := doc.Links["self"].Href; href != "/songs/5" {
+		t.Errorf("self link = %q, want /songs/5", href)
+	}
+	if _, ok := doc.Embedded["songs"]; !ok {
+		t.Errorf("embedded resources = %v, want songs", doc.Embedded)
+	}
+}
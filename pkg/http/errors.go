@@ -0,0 +1,76 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jeremybouzigard/server"
+)
+
+// The interfaces below are implemented by structured errors of the library
+// services, such as validation or constraint errors, that know how they should
+// be reported to clients. They are matched with errors.As so that wrapped
+// errors are recognized too. The library package cannot return server.Error
+// values itself without importing this module.
+
+// statusCoder is implemented by errors that map to an HTTP status code.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// errorCoder is implemented by errors with an application-specific code.
+type errorCoder interface {
+	ErrorCode() string
+}
+
+// sourcePointer is implemented by errors caused by a specific member of the
+// request document, identified by a JSON Pointer.
+type sourcePointer interface {
+	SourcePointer() string
+}
+
+// sourceParameter is implemented by errors caused by a specific query
+// parameter.
+type sourceParameter interface {
+	SourceParameter() string
+}
+
+// libraryError converts a structured service error to an API error message
+// and its HTTP status code. It reports false for errors that do not carry a
+// valid client or server error status code. The message of a server error is
+// not sent to clients, as it may reveal internal details.
+func libraryError(err error) (*server.Error, int, bool) {
+	var sc statusCoder
+	if !errors.As(err, &sc) {
+		return nil, 0, false
+	}
+	code := sc.StatusCode()
+	if code < 400 || code > 599 {
+		return nil, 0, false
+	}
+
+	e := &server.Error{
+		Status: strconv.Itoa(code),
+		Title:  http.StatusText(code),
+		Detail: err.Error()}
+	if code >= 500 {
+		e.Detail = server.NewInternalServerError().Detail
+	}
+	var ec errorCoder
+	if errors.As(err, &ec) {
+		e.Code = ec.ErrorCode()
+	}
+	var sp sourcePointer
+	if errors.As(err, &sp) {
+		e.Source = &server.ErrorSource{Pointer: sp.SourcePointer()}
+	}
+	var spa sourceParameter
+	if errors.As(err, &spa) {
+		if e.Source == nil {
+			e.Source = &server.ErrorSource{}
+		}
+		e.Source.Parameter = spa.SourceParameter()
+	}
+	return e, code, true
+}
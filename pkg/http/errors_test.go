@@ -0,0 +1,66 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// conflictError is a structured service error reported as a 409.
+type conflictError struct{}
+
+func (conflictError) Error() string           { return "title already taken" }
+func (conflictError) StatusCode() int         { return http.StatusConflict }
+func (conflictError) ErrorCode() string       { return "duplicate-title" }
+func (conflictError) SourcePointer() string   { return "/data/attributes/title" }
+func (conflictError) SourceParameter() string { return "title" }
+
+// unavailableError is a structured service error reported as a 503.
+type unavailableError struct{}
+
+func (unavailableError) Error() string   { return "replica db-7 unreachable" }
+func (unavailableError) StatusCode() int { return http.StatusServiceUnavailable }
+
+func TestHandleLibraryErrors(t *testing.T) {
+	h, _ := newTestHandler(t)
+	var buf bytes.Buffer
+	h.Logger = log.New(&buf, "", 0)
+	songs := h.SongService.(*songService)
+
+	songs.err = fmt.Errorf("updating song: %w", conflictError{})
+	w := serve(h, "GET", "/songs/5", nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("conflict: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	errs := decodeErrors(t, w)
+	if len(errs) != 1 {
+		t.Fatalf("conflict: errors = %+v, want one error", errs)
+	}
+	e := errs[0]
+	if e.Status != "409" || e.Code != "duplicate-title" || e.Detail != songs.err.Error() {
+		t.Errorf("conflict: error = %+v, want status 409, code duplicate-title, and detail %q", e, songs.err)
+	}
+	if e.Source == nil || e.Source.Pointer != "/data/attributes/title" || e.Source.Parameter != "title" {
+		t.Errorf("conflict: source = %+v, want pointer /data/attributes/title and parameter title", e.Source)
+	}
+
+	buf.Reset()
+	songs.err = unavailableError{}
+	w = serve(h, "GET", "/songs/5", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unavailable: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	errs = decodeErrors(t, w)
+	if len(errs) != 1 || errs[0].Status != "503" {
+		t.Fatalf("unavailable: errors = %+v, want one 503 error", errs)
+	}
+	if strings.Contains(errs[0].Detail, "db-7") {
+		t.Errorf("unavailable: detail %q reveals the service error", errs[0].Detail)
+	}
+	if !strings.Contains(buf.String(), "db-7") {
+		t.Errorf("unavailable: log = %q, want the service error", buf.String())
+	}
+}
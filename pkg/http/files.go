@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// serveFile serves the named generated HLS file of the given song with the
+// given content type. When the client accepts gzip and a precompressed copy of
+// the file exists, the copy is served instead with a gzip content encoding.
+//
+// Byte-range requests are supported so that players can seek within a
+// segment: http.ServeFile answers a satisfiable Range with a 206 and the exact
+// Content-Length of the part, and an unsatisfiable one with a 416.
+//
+// Generated files never change once written, so the response carries an ETag
+// derived from the song ID and the file's modification time, and may be
+// cached for CacheMaxAge. http.ServeFile answers a matching If-None-Match or
+// If-Modified-Since with a 304. When streaming is restricted by region, only
+// the client may cache the file, so that a shared cache does not serve it to
+// clients in a blocked country.
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, songID string,
+	name string, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if precompressedExts[filepath.Ext(name)] {
+		addVary(w.Header(), "Accept-Encoding")
+		if acceptsEncoding(r, "gzip") {
+			if _, err := os.Stat(name + ".gz"); err == nil {
+				w.Header().Set("Content-Encoding", "gzip")
+				name += ".gz"
+			}
+		}
+	}
+	if info, err := os.Stat(name); err == nil {
+		etag := fmt.Sprintf("\"%s-%s-%x\"", songID, filepath.Base(name), info.ModTime().UnixNano())
+		w.Header().Set("ETag", etag)
+		if h.CacheMaxAge > 0 {
+			maxAge := strconv.Itoa(int(h.CacheMaxAge.Seconds()))
+			scope := "public"
+			if h.regionRestricted() {
+				scope = "private"
+			}
+			w.Header().Set("Cache-Control", scope+", max-age="+maxAge)
+		}
+	}
+	http.ServeFile(w, r, name)
+}
+
+// withinDir reports whether the cleaned path lies inside the directory dir, so
+// that a path built from request input cannot escape it.
+func withinDir(dir string, path string) bool {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	return strings.HasPrefix(filepath.Clean(path), prefix)
+}
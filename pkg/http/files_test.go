@@ -0,0 +1,203 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// streamSong requests the stream of song 5 so that its segments are generated.
+func streamSong(t *testing.T, h *Handler) {
+	t.Helper()
+	if w := serve(h, "GET", "/songs/5/stream", nil); w.Code != http.StatusOK {
+		t.Fatalf("stream: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestSegmentRange(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := serve(h, "GET", "/songs/5/fileSequence0.aac", map[string]string{"Range": "bytes=2-5"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusPartialContent)
+	}
+	if got, want := w.Body.String(), string(segmentBody[2:6]); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	wantRange := fmt.Sprintf("bytes 2-5/%d", len(segmentBody))
+	if cr := w.Header().Get("Content-Range"); cr != wantRange {
+		t.Errorf("Content-Range = %q, want %q", cr, wantRange)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "4" {
+		t.Errorf("Content-Length = %q, want 4", cl)
+	}
+	if ar := w.Header().Get("Accept-Ranges"); ar != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", ar)
+	}
+
+	w = serve(h, "GET", "/songs/5/fileSequence0.aac", map[string]string{"Range": "bytes=1000-2000"})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range: status = %d, want %d", w.Code, http.StatusRequestedRangeNotSatisfiable)
+	}
+}
+
+func TestSegmentNotModified(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := serve(h, "GET", "/songs/5/fileSequence0.aac", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	w = serve(h, "GET", "/songs/5/fileSequence0.aac", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q, want none", w.Body.String())
+	}
+	w = serve(h, "GET", "/songs/5/fileSequence0.aac", map[string]string{"If-None-Match": `"stale"`})
+	if w.Code != http.StatusOK {
+		t.Errorf("stale ETag: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// countryResolver resolves every address to the same country.
+type countryResolver string
+
+func (c countryResolver) Country(ip net.IP) (string, error) {
+	return string(c), nil
+}
+
+func TestSegmentCacheControl(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := serve(h, "GET", "/songs/5/fileSequence0.aac", nil)
+	if got, want := w.Header().Get("Cache-Control"), "public, max-age=3600"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+
+	h.CountryResolver = countryResolver("US")
+	h.BlockedCountries = []string{"XX"}
+	w = serve(h, "GET", "/songs/5/fileSequence0.aac", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("region restricted: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Cache-Control"), "private, max-age=3600"; got != want {
+		t.Errorf("region restricted: Cache-Control = %q, want %q", got, want)
+	}
+}
+
+func TestServeSegmentOutsideDir(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := httptest.NewRecorder()
+	h.serveSegment(w, httptest.NewRequest("GET", "/songs/5/fileSequence0.aac", nil), "5", "", "../../etc/passwd")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "400" {
+		t.Errorf("errors = %+v, want one 400 error", errs)
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/tmp/hls/5/fileSequence0.aac", true},
+		{"/tmp/hls/5/../5/fileSequence0.aac", true},
+		{"/tmp/hls/5/../6/fileSequence0.aac", false},
+		{"/tmp/hls/5", false},
+		{"/tmp/hls/55/fileSequence0.aac", false},
+	}
+	for _, test := range tests {
+		if got := withinDir("/tmp/hls/5", test.path); got != test.want {
+			t.Errorf("withinDir(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestHeadSegment(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := serve(h, "HEAD", "/songs/5/fileSequence0.aac", map[string]string{"Want-Digest": "sha-256"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Content-Length"), strconv.Itoa(len(segmentBody)); got != want {
+		t.Errorf("Content-Length = %q, want %q", got, want)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q, want none", w.Body.String())
+	}
+}
+
+func TestMissingSegment(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+
+	w := serve(h, "GET", "/songs/5/fileSequence999.aac", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "404" {
+		t.Errorf("errors = %+v, want one 404 error", errs)
+	}
+}
+
+// fmp4Segmenter is an hls.Segmenter that writes a one-segment playlist of
+// fragmented MPEG-4 segments, with their initialization section.
+type fmp4Segmenter struct{}
+
+func (fmp4Segmenter) Segment(ctx context.Context, songPath string, destPath string) error {
+	files := map[string]string{
+		"prog_index.m3u8":   "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:10,\nfileSequence0.m4s\n#EXT-X-ENDLIST\n",
+		"init.mp4":          "init section",
+		"fileSequence0.m4s": string(segmentBody)}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(destPath, name), []byte(content), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFragmentedMP4Segments(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Segmenter = fmp4Segmenter{}
+	streamSong(t, h)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"init.mp4", "init section"},
+		{"fileSequence0.m4s", string(segmentBody)},
+	}
+	for _, test := range tests {
+		w := serve(h, "GET", "/songs/5/"+test.name, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, http.StatusOK)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != "audio/mp4" {
+			t.Errorf("%s: Content-Type = %q, want %q", test.name, got, "audio/mp4")
+		}
+		if got := w.Body.String(); got != test.body {
+			t.Errorf("%s: body = %q, want %q", test.name, got, test.body)
+		}
+	}
+}
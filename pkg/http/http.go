@@ -1,20 +1,33 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jeremybouzigard/library"
 	"github.com/jeremybouzigard/server"
+	"github.com/jeremybouzigard/server/pkg/artwork"
 	"github.com/jeremybouzigard/server/pkg/hls"
+	"github.com/jeremybouzigard/server/pkg/lyrics"
 )
 
 // Handler contains an HTTP router, a collection of all services to handle HTTP
@@ -24,79 +37,405 @@ type Handler struct {
 	Logger  *log.Logger
 	TempDir string
 
+	// TempRoot is the directory the temporary directory for HLS files is
+	// created in. Defaults to the operating system's temporary directory.
+	TempRoot string
+
+	// LogLevel is the least severe level of the messages written to Logger:
+	// "info", the default, logs every request, and "error" only failures.
+	LogLevel string
+
+	// StructuredLogger, when set, receives the server's log messages with
+	// their fields, such as the method, path, status, and error of a failed
+	// request, in place of Logger. Set a *slog.Logger to log JSON.
+	StructuredLogger StructuredLogger
+
+	// Addr is the TCP address the server listens on, in the form "host:port".
+	// An empty host listens on all interfaces. Defaults to ":8080".
+	Addr string
+
+	// CertFile and KeyFile are the paths of a TLS certificate and its private
+	// key. When both are set the server is served over HTTPS, accepting TLS 1.2
+	// or later; otherwise it is served over plain HTTP.
+	CertFile string
+	KeyFile  string
+
+	// AllowedOrigins lists the origins, such as "https://example.com", of
+	// browser applications allowed to call the API across origins. "*" allows
+	// any origin. By default only same-origin requests are allowed.
+	AllowedOrigins []string
+
+	// CountryResolver and BlockedCountries restrict streaming by region.
+	// Clients whose IP address resolves to one of the blocked country codes
+	// receive a 451 from the streaming and download routes; metadata routes
+	// are unaffected.
+	CountryResolver  CountryResolver
+	BlockedCountries []string
+
+	// MaxIDLength bounds the number of digits accepted in route ID variables,
+	// such as the song ID in /songs/{id}. Longer IDs are rejected with a 400
+	// before any service is called. Zero disables the check.
+	MaxIDLength int
+
+	// StrictQueries rejects list requests with query parameters the endpoint
+	// does not support, such as a misspelled filter, with a 400 listing them.
+	// By default unknown query parameters are ignored.
+	StrictQueries bool
+
 	GenreService  library.GenreService
 	AlbumService  library.AlbumService
 	ArtistService library.ArtistService
+
+	// SongService serves the song routes. Including the related albums and
+	// artists of songs with the include query parameter requires it to also
+	// implement server.SongRelationships; without it such requests fail with
+	// a 400.
 	SongService   library.SongService
+	SearchService server.SearchService
+
+	// ServiceTimeout bounds each call to a library service made while handling
+	// a request. A call that runs longer fails the request with a 504, and
+	// one abandoned because the client went away fails it with a 503. Zero
+	// leaves calls unbounded. Defaults to 30 seconds.
+	//
+	// Only services implementing the context-aware interfaces of the server
+	// package, such as server.SongContextService, stop working when a call is
+	// abandoned. The goroutine running an abandoned call to any other service
+	// lives on until the service returns, so a slow backend under a short
+	// timeout can accumulate them.
+	ServiceTimeout time.Duration
+
+	// Segmenter generates the HLS playlist and segments of a song. Defaults to
+	// Apple's mediafilesegmenter tool with its default segment duration; set
+	// an hls.MediaFileSegmenter with a TargetDuration or Format to tune it.
+	Segmenter hls.Segmenter
+
+	// DirMode is the permission mode of the temporary directory and of the
+	// per-song directories of generated HLS files. FileMode, when nonzero, is
+	// applied to the generated files; otherwise they keep the mode the
+	// segmenter gives them. Loosen these when a front-end server running as
+	// another user reads the files directly. DirMode defaults to 0700.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+
+	// MaxPlaylistAge forces a song to be segmented again once its playlist is
+	// older than this, so that changes to the segmenter or its settings reach
+	// songs segmented before them. Zero never forces regeneration.
+	MaxPlaylistAge time.Duration
+
+	// SegmentTTL is how long the generated HLS files of a song are kept after
+	// they were last served. A background janitor, run by Start, removes idle
+	// songs' files so that they do not accumulate for the server's lifetime.
+	// Zero keeps them until shutdown.
+	SegmentTTL time.Duration
+
+	// WarmSongIDs lists songs to segment in the background when Start is
+	// called, such as recently played ones, so that clients streaming them do
+	// not wait for the segmenter. WarmWorkers bounds how many are segmented at
+	// a time, and defaults to 2.
+	WarmSongIDs []string
+	WarmWorkers int
+
+	// CacheMaxAge is how long clients and shared caches may reuse a served
+	// playlist or segment without revalidating it. Defaults to one hour.
+	CacheMaxAge time.Duration
+
+	// SegmentDigests sends a SHA-256 checksum of each media segment body in a
+	// Digest trailer, so that clients can verify the segment. Clients can also
+	// request it by sending a Want-Digest header.
+	SegmentDigests bool
+
+	// BitrateLadder lists the bitrates, in bits per second, of the variant
+	// streams offered by a song's adaptive-bitrate master playlist, so that
+	// clients on poor connections can switch to a lower bitrate. The Segmenter
+	// must be an hls.VariantSegmenter to offer them. Defaults to 64, 128, and
+	// 256 kbit/s.
+	BitrateLadder []int
+
+	// PrecompressPlaylists stores a gzip-compressed copy of each generated
+	// playlist when a song is segmented, which is served to clients that
+	// accept gzip.
+	PrecompressPlaylists bool
+
+	// ProxyTargets maps path prefixes, such as "/podcasts", to the URL of an
+	// upstream server that requests under them are reverse-proxied to, so
+	// that this server can sit in front of a companion service. The original
+	// path and query are preserved. Requests under no prefix and matching no
+	// route are answered with a 404.
+	ProxyTargets map[string]string
+
+	// ProxyTimeout bounds connecting to an upstream and waiting for its
+	// response headers; an upstream that exceeds it is answered with a 504.
+	// Defaults to 30 seconds.
+	ProxyTimeout time.Duration
+
+	// ArtworkSource provides the cover artwork served for each album. Defaults
+	// to image files, such as cover.jpg, stored next to the album's songs.
+	ArtworkSource artwork.Source
+
+	// MediaRoot is the directory the original song files must lie in to be
+	// downloaded or played progressively, so that a song whose file path
+	// points elsewhere cannot be used to read arbitrary files. Original files
+	// are not served when it is unset, the default: downloads get a 404 and
+	// streams are only served as HLS, with a 406 for clients that do not
+	// accept playlists.
+	MediaRoot string
+
+	// LyricsSource provides the lyrics served for each song. Defaults to
+	// lyrics files stored next to the song file.
+	LyricsSource lyrics.Source
+
+	songLocks  songLocks
+	songAccess songAccess
+	proxies    []*prefixProxy
+	shutdown   context.Context
 }
 
+// defaultServiceTimeout bounds library service calls when no timeout is
+// configured.
+const defaultServiceTimeout = 30 * time.Second
+
+// defaultCacheMaxAge is how long generated HLS files may be cached when no
+// duration is configured.
+const defaultCacheMaxAge = time.Hour
+
+// segmentPattern matches the names of the media segment files of every
+// hls.Format, and of the initialization section of fragmented MPEG-4 segments.
+const segmentPattern = `fileSequence[0-9]+\.(?:aac|m4s)|init\.mp4`
+
+// notFoundRoute is the name of the catch-all route for unknown paths.
+const notFoundRoute = "notFound"
+
+// defaultAddr is the address the server listens on when none is configured.
+const defaultAddr = ":8080"
+
+// defaultDirMode is the permission mode of the directories of generated HLS
+// files when none is configured.
+const defaultDirMode os.FileMode = 0700
+
 // NewHandler returns a new instance of a Handler.
 func NewHandler() *Handler {
 	h := &Handler{
-		Router: mux.NewRouter(),
-		Logger: log.New(os.Stderr, "", log.LstdFlags)}
+		Router:         mux.NewRouter(),
+		Addr:           defaultAddr,
+		DirMode:        defaultDirMode,
+		LyricsSource:   lyrics.SidecarSource{},
+		ArtworkSource:  artwork.SidecarSource{},
+		Segmenter:      hls.MediaFileSegmenter{},
+		Logger:         log.New(os.Stderr, "", log.LstdFlags),
+		MaxIDLength:    18,
+		ServiceTimeout: defaultServiceTimeout,
+		CacheMaxAge:    defaultCacheMaxAge,
+		BitrateLadder:  []int{64000, 128000, 256000}}
 	return h
 }
 
 // setTempDir creates a temporary directory to store the files generated for
 // HTTP Live Streaming, including index files (playlists) and media stream
-// segments.
+// segments, in TempRoot when set.
 func (h *Handler) setTempDir() error {
-	dir, err := ioutil.TempDir("", "hls")
+	dir, err := ioutil.TempDir(h.TempRoot, "hls")
 	if err != nil {
-		h.Logger.Fatal(err)
+		return err
+	}
+	if err := os.Chmod(dir, h.dirMode()); err != nil {
+		os.RemoveAll(dir)
 		return err
 	}
 	h.TempDir = dir
 	return nil
 }
 
-// StartServer performs an initial setup and then starts the media server.
-func (h *Handler) StartServer() {
-	// Creates temporary directory for HLS files.
-	err := h.setTempDir()
-	if err != nil {
-		return
+// StartServer registers the routes and then starts the media server. It
+// blocks until the server is shut down by an interrupt signal, in which case it
+// returns nil, or until setup or listening fails, in which case it returns the
+// error.
+func (h *Handler) StartServer() error {
+	// Validates the listen address before doing any setup.
+	addr := h.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	if err := validateAddr(addr); err != nil {
+		return err
+	}
+	if (h.CertFile == "") != (h.KeyFile == "") {
+		return errors.New("both a TLS certificate and key file are required to serve HTTPS")
 	}
 
-	// Routes HTTP requests to the appropriate handler function.
-	h.Router.HandleFunc("/albums", h.handleGetAlbums).Methods("GET")
-	h.Router.HandleFunc("/albums/{id:[0-9]+}", h.handleGetAlbumByID).Methods("GET")
-	h.Router.HandleFunc("/genres", h.handleGetGenres).Methods("GET")
-	h.Router.HandleFunc("/artists", h.handleGetArtists).Methods("GET")
-	h.Router.HandleFunc("/artists/{id:[0-9]+}", h.handleGetArtistByID).Methods("GET")
-	h.Router.HandleFunc("/songs", h.handleGetSongs).Methods("GET")
-	h.Router.HandleFunc("/songs/{id:[0-9]+}", h.handleGetSongByID).Methods("GET")
-	h.Router.HandleFunc("/songs/{id:[0-9]+}/stream", h.handleGetStreamPlaylist).Methods("GET")
-	h.Router.HandleFunc("/songs/{id:[0-9]+}/{seg:fileSequence[0-9]+.aac}", h.handleGetStreamSegment).Methods("GET")
-	h.Router.PathPrefix("/").HandlerFunc(handleNotFound)
+	if err := h.RegisterRoutes(); err != nil {
+		return err
+	}
+
+	// Starts the background work, until the server shuts down.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.Start(ctx)
 
 	// Creates server.
-	srv := &http.Server{Addr: ":8080", Handler: h.Router}
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   h,
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
 
 	// Defines shutdown behavior.
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt)
+	defer signal.Stop(sigint)
 	idleConnsClosed := make(chan struct{})
+	serveEnded := make(chan struct{})
+	defer close(serveEnded)
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
+		// Stops waiting for a signal when serving fails, such as when the
+		// port is already in use, rather than leaking the goroutine.
+		select {
+		case <-sigint:
+		case <-serveEnded:
+			return
+		}
 
-		// Shuts down when an interrupt signal is received.
+		// Shuts down when an interrupt signal is received. Segmenting is
+		// canceled first, so that requests waiting for a segmenter fail
+		// promptly, then active requests are waited for.
+		cancel()
 		if err := srv.Shutdown(context.Background()); err != nil {
-			h.Logger.Printf("HTTP server Shutdown: %v", err)
+			h.log().Error("HTTP server shutdown failed", "error", err)
 		}
 
 		// On shutdown, removes temporary directory and closes idle connections.
-		h.Logger.Printf("HTTP server Shutdown")
+		h.log().Info("HTTP server shut down")
 		os.RemoveAll(h.TempDir)
 		close(idleConnsClosed)
 	}()
 
-	// Begins listening for and serving requests.
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		h.Logger.Printf("HTTP server ListenAndServe: %v", err)
+	// Begins listening for and serving requests. When listening fails, such as
+	// when the port is already in use, the shutdown goroutine never runs, so
+	// the temporary directory is removed here instead.
+	if err := h.listenAndServe(srv); err != http.ErrServerClosed {
+		os.RemoveAll(h.TempDir)
+		return err
 	}
 	<-idleConnsClosed
+	return nil
+}
+
+// Start begins the background work of the media server, which runs until ctx
+// is canceled: the janitor removing idle HLS files when SegmentTTL is set and
+// the warm-up of WarmSongIDs. Canceling ctx also cancels segmenting in
+// progress, so that no segmenter process outlives the server, while other
+// requests are left to finish. StartServer calls it; a caller mounting the
+// Handler on its own server should call it after RegisterRoutes and before
+// serving requests, and cancel ctx when shutting down.
+func (h *Handler) Start(ctx context.Context) {
+	h.shutdown = ctx
+
+	// Starts removing idle HLS files.
+	if h.SegmentTTL > 0 {
+		go h.runJanitor(ctx)
+	}
+
+	// Segments the songs to warm up, until done.
+	if len(h.WarmSongIDs) > 0 {
+		go h.warmUp(ctx)
+	}
+}
+
+// RegisterRoutes performs the setup needed to serve requests, creating the
+// temporary directory for HLS files, and registers the routes and middleware of
+// the media server on the Router. It lets the Handler be mounted on a server
+// other than the one StartServer runs, such as an httptest.Server. Routes added
+// to the Router before calling RegisterRoutes take precedence over the
+// catch-all route registered last. The caller is responsible for removing
+// TempDir when done, and for calling Start to run the background work.
+func (h *Handler) RegisterRoutes() error {
+	if err := h.setProxies(); err != nil {
+		return err
+	}
+
+	// Creates temporary directory for HLS files.
+	if err := h.setTempDir(); err != nil {
+		return fmt.Errorf("creating temporary directory: %v", err)
+	}
+
+	// Routes HTTP requests to the appropriate handler function.
+	h.Router.HandleFunc("/albums/schema", handleGetSchema(albumParams)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/albums", h.handleGetAlbums).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/albums/{id:[0-9]+}", h.handleGetAlbumByID).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/albums/{id:[0-9]+}/artwork", h.handleGetAlbumArtwork).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/genres", h.handleGetGenres).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/artists/schema", handleGetSchema(artistParams)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/artists", h.handleGetArtists).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/artists/{id:[0-9]+}", h.handleGetArtistByID).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/search", h.handleSearch).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/schema", handleGetSchema(songParams)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs", h.handleGetSongs).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}", h.handleGetSongByID).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/lyrics", h.handleGetLyrics).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/download", h.restrictRegion(h.handleGetDownload)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/stream", h.restrictRegion(h.handleGetStreamPlaylist)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/{seg:"+segmentPattern+"}", h.restrictRegion(h.handleGetStreamSegment)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/master.m3u8", h.restrictRegion(h.handleGetMasterPlaylist)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/{bitrate:[0-9]+}/prog_index.m3u8", h.restrictRegion(h.handleGetVariantPlaylist)).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.HandleFunc("/songs/{id:[0-9]+}/{bitrate:[0-9]+}/{seg:"+segmentPattern+"}", h.restrictRegion(h.handleGetStreamSegment)).Methods("GET", "HEAD", "OPTIONS")
+	h.registerMetrics()
+	h.Router.PathPrefix("/").HandlerFunc(h.handleUnmatched).Name(notFoundRoute)
+	h.Router.Use(h.logRequests)
+	h.Router.Use(h.recoverPanics)
+	h.Router.Use(h.compressJSON)
+	h.Router.Use(h.cors)
+	h.Router.Use(h.validateIDs)
+	return nil
+}
+
+// ServeHTTP dispatches the request to the handler of the route it matches, so
+// that a Handler can be used as an http.Handler once its routes are
+// registered.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Router.ServeHTTP(w, r)
+}
+
+// listenAndServe serves over HTTPS when a certificate is configured, and over
+// plain HTTP otherwise.
+func (h *Handler) listenAndServe(srv *http.Server) error {
+	if h.CertFile != "" {
+		return srv.ListenAndServeTLS(h.CertFile, h.KeyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+// validateAddr checks that addr is a "host:port" address with a valid port.
+func validateAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid address %q: port must be a number from 0 to 65535", addr)
+	}
+	return nil
+}
+
+// validateIDs is middleware that rejects a request with a 400 when any of its
+// route ID variables, including those of parent resources in nested routes,
+// is longer than MaxIDLength.
+func (h *Handler) validateIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.MaxIDLength > 0 {
+			for name, value := range mux.Vars(r) {
+				if isIDVar(name) && len(value) > h.MaxIDLength {
+					err := fmt.Errorf("%s must not exceed %d digits", name, h.MaxIDLength)
+					handleError(w, err, http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isIDVar reports whether the named route variable holds a resource ID.
+func isIDVar(name string) bool {
+	return name == "id" || strings.HasSuffix(name, "ID")
 }
 
 // handleGetSongByID handles a request to get a song with the given ID.
@@ -104,7 +443,7 @@ func (h *Handler) handleGetSongByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if len(id) > 0 {
-		a, err := h.SongService.Song(id)
+		a, err := h.song(r.Context(), id)
 		if err != nil {
 			handleError(w, err, http.StatusInternalServerError)
 		} else if a == nil {
@@ -113,7 +452,43 @@ func (h *Handler) handleGetSongByID(w http.ResponseWriter, r *http.Request) {
 			var songs []*library.Song
 			songs = append(songs, a)
 			response := server.SongResponse{Data: songs}
-			encodeJSON(w, response)
+			encodeResponse(w, r, response)
+		}
+	}
+}
+
+// lrcContentType is the media type of timestamped lyrics in the LRC format.
+const lrcContentType = "text/x-lrc"
+
+// handleGetLyrics handles a request to get the lyrics of the song with the
+// given ID. Timestamped LRC lyrics are served to clients that accept them and
+// plain text lyrics are served otherwise.
+func (h *Handler) handleGetLyrics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if len(id) > 0 {
+		song, err := h.song(r.Context(), id)
+		if err != nil {
+			handleError(w, err, http.StatusInternalServerError)
+			return
+		} else if song == nil || h.LyricsSource == nil {
+			handleNotFound(w, r)
+			return
+		}
+		l, err := h.LyricsSource.Lyrics(song)
+		if err != nil {
+			handleError(w, err, http.StatusInternalServerError)
+		} else if l == nil {
+			handleNotFound(w, r)
+		} else {
+			addVary(w.Header(), "Accept")
+			if l.LRC != "" && accepts(r, lrcContentType) {
+				w.Header().Set("Content-Type", lrcContentType+"; charset=utf-8")
+				io.WriteString(w, l.LRC)
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				io.WriteString(w, l.Plain)
+			}
 		}
 	}
 }
@@ -121,15 +496,31 @@ func (h *Handler) handleGetSongByID(w http.ResponseWriter, r *http.Request) {
 // handleGetSongs handles a request to get song data.
 func (h *Handler) handleGetSongs(w http.ResponseWriter, r *http.Request) {
 	v := r.URL.Query()
-	queries := parseQueries(v)
-	songs, err := h.SongService.Songs(queries)
+	queries, errs := h.parseQueries(v, songParams)
+	includes, e := songParams.parseInclude(v.Get("include"))
+	if e != nil {
+		errs = append(errs, e)
+	} else if _, ok := h.SongService.(server.SongRelationships); len(includes) > 0 && !ok {
+		detail := "related resources cannot be included with these results"
+		errs = append(errs, server.NewInvalidParameterError("include", detail))
+	}
+	if errs != nil {
+		writeError(w, http.StatusBadRequest, errs...)
+		return
+	}
+	songs, err := h.songs(r.Context(), queries)
 	if err != nil {
 		handleError(w, err, http.StatusInternalServerError)
 	} else if songs == nil {
 		handleNotFound(w, r)
+	} else if meta, err := h.pageMeta(r.Context(), h.SongService, queries, len(songs)); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+	} else if included, err := h.included(r.Context(), songs, includes); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
 	} else {
-		response := server.SongResponse{Data: songs}
-		encodeJSON(w, response)
+		setTotalCount(w, meta)
+		response := server.SongResponse{Data: songs, Meta: meta, Included: included}
+		encodeResponse(w, r, response)
 	}
 }
 
@@ -138,7 +529,7 @@ func (h *Handler) handleGetArtistByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if len(id) > 0 {
-		a, err := h.ArtistService.Artist(id)
+		a, err := h.artist(r.Context(), id)
 		if err != nil {
 			handleError(w, err, http.StatusInternalServerError)
 		} else if a == nil {
@@ -147,7 +538,7 @@ func (h *Handler) handleGetArtistByID(w http.ResponseWriter, r *http.Request) {
 			var artists []*library.Artist
 			artists = append(artists, a)
 			response := server.ArtistResponse{Data: artists}
-			encodeJSON(w, response)
+			encodeResponse(w, r, response)
 		}
 	}
 }
@@ -155,26 +546,50 @@ func (h *Handler) handleGetArtistByID(w http.ResponseWriter, r *http.Request) {
 // handleGetArtists handles a request to get artist data.
 func (h *Handler) handleGetArtists(w http.ResponseWriter, r *http.Request) {
 	v := r.URL.Query()
-	queries := parseQueries(v)
-	artists, err := h.ArtistService.Artists(queries)
+	queries, errs := h.parseQueries(v, artistParams)
+	if errs != nil {
+		writeError(w, http.StatusBadRequest, errs...)
+		return
+	}
+	artists, err := h.artists(r.Context(), queries)
 	if err != nil {
 		handleError(w, err, http.StatusInternalServerError)
 	} else if artists == nil {
 		handleNotFound(w, r)
+	} else if meta, err := h.pageMeta(r.Context(), h.ArtistService, queries, len(artists)); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
 	} else {
-		response := server.ArtistResponse{Data: artists}
-		encodeJSON(w, response)
+		setTotalCount(w, meta)
+		response := server.ArtistResponse{Data: artists, Meta: meta}
+		encodeResponse(w, r, response)
+	}
+}
+
+// handleSearch handles a request to search for songs, albums, and artists
+// matching the term given by the q query parameter.
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	term := r.URL.Query().Get("q")
+	if term == "" {
+		e := server.NewInvalidParameterError("q", "q must not be empty")
+		writeError(w, http.StatusBadRequest, e)
+	} else if h.SearchService == nil {
+		handleNotFound(w, r)
+	} else if songs, albums, artists, err := h.search(r.Context(), term); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+	} else {
+		response := server.SearchResponse{Songs: songs, Albums: albums, Artists: artists}
+		encodeResponse(w, r, response)
 	}
 }
 
 // handleGetGenres handles a request to get all genre data.
 func (h *Handler) handleGetGenres(w http.ResponseWriter, r *http.Request) {
-	genres, err := h.GenreService.Genres()
+	genres, err := h.genres(r.Context())
 	if err != nil {
 		handleError(w, err, http.StatusInternalServerError)
 	} else {
 		response := server.GenreResponse{Data: genres}
-		encodeJSON(w, response)
+		encodeResponse(w, r, response)
 	}
 }
 
@@ -183,14 +598,16 @@ func (h *Handler) handleGetAlbumByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if len(id) > 0 {
-		a, err := h.AlbumService.Album(id)
+		a, err := h.album(r.Context(), id)
 		if err != nil {
 			handleError(w, err, http.StatusInternalServerError)
+		} else if a == nil {
+			handleNotFound(w, r)
 		} else {
 			var albums []*library.Album
 			albums = append(albums, a)
 			response := server.AlbumResponse{Data: albums}
-			encodeJSON(w, response)
+			encodeResponse(w, r, response)
 		}
 	}
 }
@@ -198,89 +615,330 @@ func (h *Handler) handleGetAlbumByID(w http.ResponseWriter, r *http.Request) {
 // handleGetAlbums handles a request to get albums.
 func (h *Handler) handleGetAlbums(w http.ResponseWriter, r *http.Request) {
 	v := r.URL.Query()
-	queries := parseQueries(v)
-	albums, err := h.AlbumService.Albums(queries)
+	queries, errs := h.parseQueries(v, albumParams)
+	if errs != nil {
+		writeError(w, http.StatusBadRequest, errs...)
+		return
+	}
+	albums, err := h.albums(r.Context(), queries)
 	if err != nil {
 		handleError(w, err, http.StatusInternalServerError)
+	} else if meta, err := h.pageMeta(r.Context(), h.AlbumService, queries, len(albums)); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
 	} else {
-		response := server.AlbumResponse{Data: albums}
-		encodeJSON(w, response)
+		setTotalCount(w, meta)
+		response := server.AlbumResponse{Data: albums, Meta: meta}
+		encodeResponse(w, r, response)
 	}
 }
 
 // handleGetStreamPlaylist handles a request to get the stream index file for
 // the given song ID. An index file, or playlist, provides an ordered list of
-// paths of the media segment files.
+// paths of the media segment files. Clients that cannot play HLS and accept
+// audio instead are served the original file for progressive playback, when a
+// MediaRoot is set.
 func (h *Handler) handleGetStreamPlaylist(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	songID := vars["id"]
 	if len(songID) > 0 {
-		song, err := h.SongService.Song(songID)
+		addVary(w.Header(), "Accept")
+		song, err := h.song(r.Context(), songID)
 		if err != nil {
 			handleError(w, err, http.StatusInternalServerError)
 		} else if song == nil {
 			handleNotFound(w, r)
+		} else if progressive(r, song.Attributes.FilePath) {
+			if h.MediaRoot == "" {
+				e := server.NewNotAcceptableError("the stream is only available as an HLS playlist")
+				writeError(w, http.StatusNotAcceptable, e)
+				return
+			}
+			h.serveOriginal(w, r, song.Attributes.FilePath, false)
 		} else {
 			h.servePlaylist(w, r, songID, song.Attributes.FilePath)
 		}
 	}
 }
 
+// playlistTypes lists the media types of HLS playlists, in the lower case
+// accepts compares them in.
+var playlistTypes = []string{"application/x-mpegurl", "application/vnd.apple.mpegurl"}
+
+// progressive reports whether the request for the stream of the song file at
+// songPath should be served the file itself rather than an HLS playlist,
+// because the client does not accept playlists but accepts MP3 audio or the
+// file's own type.
+func progressive(r *http.Request, songPath string) bool {
+	for _, t := range playlistTypes {
+		if accepts(r, t) {
+			return false
+		}
+	}
+	fileType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(songPath)))
+	return accepts(r, "audio/mpeg") || (fileType != "" && accepts(r, fileType))
+}
+
 // servePlaylist serves the stream index (playlist) file for the given song ID.
 func (h *Handler) servePlaylist(w http.ResponseWriter, r *http.Request,
 	songID string, songPath string) {
-	playlistPath := fmt.Sprintf("%s/%s/prog_index.m3u8", h.TempDir, songID)
-	if _, err := os.Stat(playlistPath); os.IsNotExist(err) {
-		playlistDir := fmt.Sprintf("%s/%s", h.TempDir, songID)
-		os.Mkdir(playlistDir, 0700)
-		hls.Segment(songPath, playlistDir)
+	playlistPath, unpin, err := h.segment(r.Context(), songID, songPath)
+	if errors.Is(err, exec.ErrNotFound) {
+		e := server.NewInternalServerError()
+		e.Detail = "streaming unavailable: media segmenter not found"
+		writeError(w, http.StatusInternalServerError, e)
+		return
+	} else if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer unpin()
+	h.serveFile(w, r, songID, playlistPath, "application/x-mpegURL")
+}
+
+// segment generates the playlist and media segments of the given song, unless
+// they already exist, and returns the path of the playlist with the function
+// that unpins the song's files, which the caller must call once done serving
+// them. Segmentation is stopped when ctx is canceled.
+func (h *Handler) segment(ctx context.Context, songID string, songPath string) (string, func(), error) {
+	playlistDir := fmt.Sprintf("%s/%s", h.TempDir, songID)
+	playlistPath := fmt.Sprintf("%s/prog_index.m3u8", playlistDir)
+
+	// Removes only the files of the default stream, which shares the song's
+	// directory with the variant streams.
+	remove := func() { removeFiles(playlistDir, streamFiles) }
+	unpin, err := h.ensureGenerated(songID, playlistPath, remove, func() error {
+		h.mkdir(playlistDir)
+		ctx, cancel := h.segmentContext(ctx)
+		defer cancel()
+		err := h.Segmenter.Segment(ctx, songPath, playlistDir)
+		observeSegment(err)
+		if err != nil {
+			return err
+		}
+		h.finishSegments(playlistDir)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return playlistPath, unpin, nil
+}
+
+// streamFiles matches the names of the files generated for the default stream
+// of a song, including precompressed copies of its playlist.
+var streamFiles = []string{"prog_index.m3u8*", "fileSequence*", "init.mp4"}
+
+// ensureGenerated calls generate to generate the files of the given song that
+// the playlist at playlistPath indexes, unless the playlist exists and has not
+// expired. The song's lock is held throughout, so that concurrent requests
+// generate the files once. remove deletes the files of an expired playlist
+// before they are generated again, and the partial output of a failed
+// generation so that the next request generates them again. On success the
+// song's files are pinned before the lock is released, so that the janitor
+// cannot remove them before they are served, and the returned function unpins
+// them.
+func (h *Handler) ensureGenerated(songID string, playlistPath string,
+	remove func(), generate func() error) (func(), error) {
+	unlock := h.songLocks.lock(songID)
+	defer unlock()
+	if info, err := os.Stat(playlistPath); err == nil && h.playlistExpired(songID, info) {
+		remove()
+	} else if err == nil {
+		return h.pinLocked(songID), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := generate(); err != nil {
+		remove()
+		return nil, err
+	}
+	return h.pinLocked(songID), nil
+}
+
+// removeFiles removes the files in dir whose names match any of the given
+// patterns.
+func removeFiles(dir string, patterns []string) {
+	for _, pattern := range patterns {
+		names, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, name := range names {
+			os.RemoveAll(name)
+		}
+	}
+}
+
+// segmentContext returns a context for segmenting a song on behalf of ctx that
+// is also canceled when the server shuts down, so that a segmenter process
+// does not outlive the server. Callers must call the returned cancel function.
+func (h *Handler) segmentContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if h.shutdown != nil {
+		go func() {
+			select {
+			case <-h.shutdown.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// finishSegments post-processes the files generated into dir: it raises the
+// version of each playlist to match its tags, precompresses the playlists when
+// configured, and applies the configured file mode.
+func (h *Handler) finishSegments(dir string) {
+	playlists, _ := filepath.Glob(filepath.Join(dir, "*.m3u8"))
+	for _, playlist := range playlists {
+		if err := hls.SetFileVersion(playlist); err != nil {
+			h.log().Error("HLS version", "error", err)
+		}
+	}
+	if h.PrecompressPlaylists {
+		if err := precompress(dir); err != nil {
+			h.log().Error("HLS precompress", "error", err)
+		}
+	}
+	if h.FileMode != 0 {
+		if err := chmodFiles(dir, h.FileMode); err != nil {
+			h.log().Error("HLS file mode", "error", err)
+		}
+	}
+}
+
+// playlistExpired reports whether the given playlist of the given song is
+// older than MaxPlaylistAge and may be regenerated, which it may not while any
+// of the song's files are being served.
+func (h *Handler) playlistExpired(songID string, info os.FileInfo) bool {
+	return h.MaxPlaylistAge > 0 && time.Since(info.ModTime()) > h.MaxPlaylistAge &&
+		!h.songAccess.pinned(songID)
+}
+
+// mkdir creates the given directory of generated HLS files, if it does not
+// exist, with the configured mode regardless of the process umask.
+func (h *Handler) mkdir(dir string) {
+	os.Mkdir(dir, h.dirMode())
+	os.Chmod(dir, h.dirMode())
+}
+
+// dirMode returns the permission mode of directories of generated HLS files.
+func (h *Handler) dirMode() os.FileMode {
+	if h.DirMode == 0 {
+		return defaultDirMode
 	}
-	w.Header().Set("Content-Type", "application/x-mpegURL")
-	http.ServeFile(w, r, playlistPath)
+	return h.DirMode
+}
+
+// chmodFiles changes the mode of each regular file in dir.
+func chmodFiles(dir string, mode os.FileMode) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Mode().IsRegular() {
+			if err := os.Chmod(filepath.Join(dir, f.Name()), mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-// handleGetStreamSegment handles a request to get a media segment file.
+// handleGetStreamSegment handles a request to get a media segment file, either
+// of the default stream or, when the route has a bitrate, of a variant stream.
 func (h *Handler) handleGetStreamSegment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	songID := vars["id"]
 	if len(songID) > 0 {
-		song, err := h.SongService.Song(songID)
+		song, err := h.song(r.Context(), songID)
 		if err != nil {
 			handleError(w, err, http.StatusInternalServerError)
 		} else if song == nil {
 			handleNotFound(w, r)
 		} else {
-			seg := vars["seg"]
-			h.serveSegment(w, r, seg, songID)
+			h.serveSegment(w, r, songID, vars["bitrate"], vars["seg"])
 		}
 	}
 }
 
-// serveSegment serves a media segment file.
+// serveSegment serves a media segment file of the given song, from the
+// directory of the given variant or, when variant is empty, of the default
+// stream.
 func (h *Handler) serveSegment(w http.ResponseWriter, r *http.Request,
-	seg string, songID string) {
-	playlistDir := fmt.Sprintf("%s/%s", h.TempDir, songID)
-	segPath := fmt.Sprintf("%s/%s", playlistDir, seg)
-	w.Header().Set("Content-Type", "audio/aac")
-	http.ServeFile(w, r, segPath)
-}
-
-// parseQueries parses URL values for known possible queries.
-func parseQueries(v url.Values) map[string]string {
-	queries := make(map[string]string, 3)
-	queries["albumID"] = v.Get("album-id")
-	queries["artistID"] = v.Get("artist-id")
-	queries["genreID"] = v.Get("genre-id")
-	return queries
+	songID string, variant string, seg string) {
+	playlistDir := filepath.Join(h.TempDir, songID, variant)
+	segPath := filepath.Clean(fmt.Sprintf("%s/%s", playlistDir, seg))
+	if !withinDir(playlistDir, segPath) {
+		handleError(w, fmt.Errorf("invalid segment name %q", seg), http.StatusBadRequest)
+		return
+	}
+	defer h.pin(songID)()
+	// Answers a segment that was never generated, or was removed, with a JSON
+	// error rather than the plain text one of http.ServeFile.
+	if info, err := os.Stat(segPath); err != nil || info.IsDir() {
+		handleNotFound(w, r)
+		return
+	}
+	// A HEAD response has no body to digest.
+	if r.Method != http.MethodHead && (h.SegmentDigests || r.Header.Get("Want-Digest") != "") {
+		dw := newDigestWriter(w)
+		h.serveFile(dw, r, songID, segPath, hls.ContentType(segPath))
+		dw.setTrailer()
+		return
+	}
+	h.serveFile(w, r, songID, segPath, hls.ContentType(segPath))
 }
 
-// encodeJSON writes the JSON-encoded response.
-func encodeJSON(w http.ResponseWriter, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(v)
+// encodeJSON writes the JSON-encoded response with the given content type. The
+// response is encoded before the status is written so that an encoding failure
+// can still be reported as a 500, and so that it can be given an ETag. A
+// request whose If-None-Match header lists that ETag gets a 304 instead.
+// Responses to HEAD requests carry the same headers with no body.
+func encodeJSON(w http.ResponseWriter, r *http.Request, contentType string, v interface{}) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(v)
 	if err != nil {
 		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	etag := jsonETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		buf.WriteTo(w)
+	}
+}
+
+// jsonETag returns a weak entity tag for the given JSON response body. It is
+// weak because the body may be sent compressed.
+func jsonETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("W/\"%x\"", sum[:16])
+}
+
+// etagMatch reports whether the If-None-Match header value lists the given
+// entity tag, using the weak comparison required for If-None-Match.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setTotalCount sets the X-Total-Count header to the total number of resources
+// matching a list request, when it is known.
+func setTotalCount(w http.ResponseWriter, meta *server.Meta) {
+	if meta.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*meta.Total))
 	}
 }
 
@@ -292,20 +950,54 @@ func handleNotFound(w http.ResponseWriter, r *http.Request) {
 
 // handleError writes an API error message to the response.
 func handleError(w http.ResponseWriter, err error, code int) {
-	var er server.ErrorResponse
 	var e *server.Error
+	var detail string
+	if err != nil {
+		detail = err.Error()
+	}
+
+	// Reports structured service errors as they describe themselves, and work
+	// that ended with its context as unavailable rather than as an internal
+	// error.
+	if code == http.StatusInternalServerError {
+		if le, lcode, ok := libraryError(err); ok {
+			recordError(w, err)
+			writeError(w, lcode, le)
+			return
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			code = http.StatusGatewayTimeout
+		} else if errors.Is(err, context.Canceled) {
+			code = http.StatusServiceUnavailable
+		}
+	}
 
 	if code == http.StatusInternalServerError {
 		e = server.NewInternalServerError()
 	} else if code == http.StatusNotFound {
 		e = server.NewStatusNotFoundError()
+	} else if code == http.StatusUnavailableForLegalReasons {
+		e = server.NewUnavailableForLegalReasonsError()
+	} else if code == http.StatusBadRequest {
+		e = server.NewBadRequestError(detail)
 	} else {
-		e = &server.Error{Status: string(code),
-			Detail: err.Error()}
+		e = &server.Error{Status: strconv.Itoa(code),
+			Title:  http.StatusText(code),
+			Detail: detail}
+	}
+	recordError(w, err)
+	writeError(w, code, e)
+}
+
+// writeError writes the given API error messages to the response with the
+// given HTTP status code. Several errors are reported together, such as every
+// invalid query parameter of a request.
+func writeError(w http.ResponseWriter, code int, errs ...*server.Error) {
+	var er server.ErrorResponse
+	for _, e := range errs {
+		er.Errors = append(er.Errors, *e)
 	}
-	er.Errors = append(er.Errors, *e)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(er)
 }
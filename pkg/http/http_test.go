@@ -0,0 +1,359 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/server"
+	"github.com/jeremybouzigard/server/pkg/hls"
+)
+
+// newSong returns a song whose file is at the given path. The attributes are
+// set through reflection so that the test does not depend on the name of the
+// library's attributes type.
+func newSong(path string) *library.Song {
+	song := &library.Song{}
+	v := reflect.ValueOf(song).Elem().FieldByName("Attributes")
+	attrs := reflect.New(v.Type().Elem())
+	attrs.Elem().FieldByName("FilePath").SetString(path)
+	v.Set(attrs)
+	return song
+}
+
+// songService is a library.SongService backed by a map of songs by ID. It
+// records the queries of the last call to Songs.
+type songService struct {
+	songs   map[string]*library.Song
+	err     error
+	calls   int32
+	queries map[string]string
+}
+
+func (s *songService) Song(id string) (*library.Song, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.songs[id], nil
+}
+
+func (s *songService) Songs(queries map[string]string) ([]*library.Song, error) {
+	atomic.AddInt32(&s.calls, 1)
+	s.queries = queries
+	if s.err != nil {
+		return nil, s.err
+	}
+	songs := []*library.Song{}
+	for _, song := range s.songs {
+		songs = append(songs, song)
+	}
+	return songs, nil
+}
+
+// albumService is a library.AlbumService backed by a map of albums by ID.
+type albumService struct {
+	albums map[string]*library.Album
+	calls  int32
+}
+
+func (s *albumService) Album(id string) (*library.Album, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.albums[id], nil
+}
+
+func (s *albumService) Albums(queries map[string]string) ([]*library.Album, error) {
+	atomic.AddInt32(&s.calls, 1)
+	albums := []*library.Album{}
+	for _, album := range s.albums {
+		albums = append(albums, album)
+	}
+	return albums, nil
+}
+
+// segmentBody is the content of the media segment written by fakeSegmenter.
+var segmentBody = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+// fakeSegmenter is an hls.Segmenter that writes a one-segment playlist and
+// counts its invocations. When block is set, each invocation waits for it to
+// be closed first.
+type fakeSegmenter struct {
+	mu    sync.Mutex
+	calls int
+	block chan struct{}
+}
+
+func (s *fakeSegmenter) Segment(ctx context.Context, songPath string, destPath string) error {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nfileSequence0.aac\n#EXT-X-ENDLIST\n"
+	if err := ioutil.WriteFile(filepath.Join(destPath, "prog_index.m3u8"), []byte(playlist), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(destPath, "fileSequence0.aac"), segmentBody, 0600)
+}
+
+// invocations returns the number of times Segment was called.
+func (s *fakeSegmenter) invocations() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// newTestHandler returns a Handler with its routes registered, a song with ID
+// 5 whose file is song.mp3 in the returned media directory, and a
+// fakeSegmenter. Its temporary directory is removed when the test ends.
+func newTestHandler(t *testing.T) (*Handler, string) {
+	t.Helper()
+	media := t.TempDir()
+	songPath := filepath.Join(media, "song.mp3")
+	if err := ioutil.WriteFile(songPath, []byte("ID3 song data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler()
+	h.Logger = log.New(ioutil.Discard, "", 0)
+	h.TempRoot = t.TempDir()
+	h.MediaRoot = media
+	h.SongService = &songService{songs: map[string]*library.Song{"5": newSong(songPath)}}
+	h.AlbumService = &albumService{albums: map[string]*library.Album{"7": {}}}
+	h.Segmenter = &fakeSegmenter{}
+	if err := h.RegisterRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(h.TempDir) })
+	return h, media
+}
+
+// serve sends a request with the given method, path, and headers to the
+// handler and returns the recorded response.
+func serve(h http.Handler, method string, path string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeErrors decodes the API error messages of the response.
+func decodeErrors(t *testing.T, w *httptest.ResponseRecorder) []server.Error {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var er server.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil {
+		t.Fatalf("decoding error response %q: %v", w.Body.String(), err)
+	}
+	return er.Errors
+}
+
+func TestValidateIDsNestedRoute(t *testing.T) {
+	h, _ := newTestHandler(t)
+	albums := h.AlbumService.(*albumService)
+
+	w := serve(h, "GET", "/albums/1234567890123456789/artwork", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	errs := decodeErrors(t, w)
+	if len(errs) != 1 || errs[0].Status != "400" {
+		t.Errorf("errors = %+v, want one 400 error", errs)
+	}
+	if n := atomic.LoadInt32(&albums.calls); n != 0 {
+		t.Errorf("album service called %d times, want 0", n)
+	}
+}
+
+func TestHandleErrorStatusCodes(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "GET", "/songs/6", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing song: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "404" {
+		t.Errorf("missing song: errors = %+v, want one 404 error", errs)
+	}
+
+	h.SongService.(*songService).err = errors.New("backend failure")
+	w = serve(h, "GET", "/songs/5", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("service error: status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "500" {
+		t.Errorf("service error: errors = %+v, want one 500 error", errs)
+	}
+}
+
+func TestGetLyrics(t *testing.T) {
+	h, media := newTestHandler(t)
+	lrc := "[00:01.00]First line\n[00:05.00]Second line\n"
+	if err := ioutil.WriteFile(filepath.Join(media, "song.lrc"), []byte(lrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"text/x-lrc", "text/x-lrc; charset=utf-8", lrc},
+		{"text/plain", "text/plain; charset=utf-8", "First line\nSecond line\n"},
+		{"", "text/plain; charset=utf-8", "First line\nSecond line\n"},
+	}
+	for _, test := range tests {
+		w := serve(h, "GET", "/songs/5/lyrics", map[string]string{"Accept": test.accept})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status = %d, want %d", test.accept, w.Code, http.StatusOK)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", test.accept, ct, test.contentType)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("Accept %q: body = %q, want %q", test.accept, w.Body.String(), test.body)
+		}
+	}
+
+	if w := serve(h, "GET", "/songs/6/lyrics", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing song: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetMissingAlbum(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "GET", "/albums/99999", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "404" {
+		t.Errorf("errors = %+v, want one 404 error", errs)
+	}
+	if w := serve(h, "GET", "/albums/7", nil); w.Code != http.StatusOK {
+		t.Errorf("existing album: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStreamNegotiation(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	tests := []struct {
+		accept      string
+		contentType string
+		progressive bool
+	}{
+		{"application/x-mpegURL", "application/x-mpegURL", false},
+		{"application/vnd.apple.mpegurl, audio/mpeg;q=0.5", "application/x-mpegURL", false},
+		{"audio/mpeg", "audio/mpeg", true},
+		{"", "application/x-mpegURL", false},
+	}
+	for _, test := range tests {
+		w := serve(h, "GET", "/songs/5/stream", map[string]string{"Accept": test.accept})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status = %d, want %d", test.accept, w.Code, http.StatusOK)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", test.accept, ct, test.contentType)
+		}
+		if got := w.Body.String() == "ID3 song data"; got != test.progressive {
+			t.Errorf("Accept %q: body = %q, want the original file: %v", test.accept, w.Body.String(), test.progressive)
+		}
+	}
+}
+
+func TestValidateAddr(t *testing.T) {
+	tests := []struct {
+		addr  string
+		valid bool
+	}{
+		{":8080", true},
+		{"localhost:0", true},
+		{"[::1]:443", true},
+		{"localhost", false},
+		{":http", false},
+		{":65536", false},
+		{":-1", false},
+	}
+	for _, test := range tests {
+		if err := validateAddr(test.addr); (err == nil) != test.valid {
+			t.Errorf("validateAddr(%q) = %v, want valid: %v", test.addr, err, test.valid)
+		}
+	}
+}
+
+func TestStartServerInvalidAddr(t *testing.T) {
+	h := NewHandler()
+	h.Logger = log.New(ioutil.Discard, "", 0)
+	h.TempRoot = t.TempDir()
+	h.Addr = "localhost:99999"
+
+	if err := h.StartServer(); err == nil {
+		t.Fatal("StartServer succeeded with an invalid address")
+	}
+	if h.TempDir != "" {
+		t.Errorf("temporary directory %q created before the address was validated", h.TempDir)
+	}
+}
+
+func TestStreamWithoutSegmenter(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Segmenter = hls.MediaFileSegmenter{}
+	t.Setenv("PATH", t.TempDir())
+
+	w := serve(h, "GET", "/songs/5/stream", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	errs := decodeErrors(t, w)
+	if want := "streaming unavailable: media segmenter not found"; len(errs) != 1 || errs[0].Detail != want {
+		t.Errorf("errors = %+v, want one with detail %q", errs, want)
+	}
+}
+
+func TestHeadListETag(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	for _, path := range []string{"/songs", "/albums", "/songs/5"} {
+		get := serve(h, "GET", path, nil)
+		head := serve(h, "HEAD", path, nil)
+		if head.Code != http.StatusOK {
+			t.Fatalf("HEAD %s: status = %d, want %d", path, head.Code, http.StatusOK)
+		}
+		etag := get.Header().Get("ETag")
+		if etag == "" || head.Header().Get("ETag") != etag {
+			t.Errorf("HEAD %s: ETag = %q, want the GET ETag %q", path, head.Header().Get("ETag"), etag)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("HEAD %s: body = %q, want none", path, head.Body.String())
+		}
+		if got, want := head.Header().Get("Content-Length"), get.Header().Get("Content-Length"); got != want {
+			t.Errorf("HEAD %s: Content-Length = %q, want %q", path, got, want)
+		}
+
+		w := serve(h, "HEAD", path, map[string]string{"If-None-Match": etag})
+		if w.Code != http.StatusNotModified {
+			t.Errorf("HEAD %s with If-None-Match: status = %d, want %d", path, w.Code, http.StatusNotModified)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"context"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/server"
+)
+
+// included fetches the named related resources of the given songs, each once,
+// or returns nil when none are named. The SongService must implement
+// server.SongRelationships.
+func (h *Handler) included(ctx context.Context, songs []*library.Song,
+	names []string) (*server.Included, error) {
+	rel, ok := h.SongService.(server.SongRelationships)
+	if len(names) == 0 || !ok {
+		return nil, nil
+	}
+	included := &server.Included{}
+	for _, name := range names {
+		switch name {
+		case "album":
+			for _, id := range relatedIDs(songs, rel.AlbumID) {
+				album, err := h.album(ctx, id)
+				if err != nil {
+					return nil, err
+				} else if album != nil {
+					included.Albums = append(included.Albums, album)
+				}
+			}
+		case "artist":
+			for _, id := range relatedIDs(songs, rel.ArtistID) {
+				artist, err := h.artist(ctx, id)
+				if err != nil {
+					return nil, err
+				} else if artist != nil {
+					included.Artists = append(included.Artists, artist)
+				}
+			}
+		}
+	}
+	return included, nil
+}
+
+// relatedIDs returns the distinct, non-empty IDs that relatedID returns for the
+// given songs, in order of first appearance.
+func relatedIDs(songs []*library.Song, relatedID func(*library.Song) string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, song := range songs {
+		if id := relatedID(song); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
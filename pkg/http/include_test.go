@@ -0,0 +1,56 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// relatedSongService is a songService that implements
+// server.SongRelationships, relating songs to albums by ID and to no artist.
+type relatedSongService struct {
+	*songService
+	albumIDs map[string]string
+}
+
+func (s *relatedSongService) AlbumID(song *library.Song) string {
+	return s.albumIDs[song.ID]
+}
+
+func (s *relatedSongService) ArtistID(song *library.Song) string {
+	return ""
+}
+
+func TestInclude(t *testing.T) {
+	h, media := newTestHandler(t)
+	songs := h.SongService.(*songService)
+	songs.songs["6"] = newSong(media + "/other.mp3")
+	for id, song := range songs.songs {
+		song.ID = id
+	}
+	h.AlbumService.(*albumService).albums["7"].ID = "7"
+
+	if w := serve(h, "GET", "/songs?include=album", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("without relationships: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	h.SongService = &relatedSongService{songs, map[string]string{"5": "7", "6": "7"}}
+	w := serve(h, "GET", "/songs?include=album,artist", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var response struct {
+		Included []map[string]interface{} `json:"included"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Included) != 1 {
+		t.Fatalf("included = %v, want album 7 once", response.Included)
+	}
+	if r := response.Included[0]; r["type"] != "albums" || r["id"] != "7" {
+		t.Errorf("included = %v, want album 7", r)
+	}
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// songAccess records when the generated HLS files of each song were last
+// served, and how many requests are serving them now.
+type songAccess struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+	pins map[string]int
+}
+
+// touch records that the files of the given song were just served.
+func (a *songAccess) touch(songID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.last == nil {
+		a.last = make(map[string]time.Time)
+	}
+	a.last[songID] = time.Now()
+}
+
+// lastAccess returns when the files of the given song were last served.
+func (a *songAccess) lastAccess(songID string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.last[songID]
+	return t, ok
+}
+
+// pin records that a request started serving the files of the given song.
+func (a *songAccess) pin(songID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pins == nil {
+		a.pins = make(map[string]int)
+	}
+	a.pins[songID]++
+}
+
+// unpin records that a request finished serving the files of the given song.
+func (a *songAccess) unpin(songID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pins[songID]--; a.pins[songID] <= 0 {
+		delete(a.pins, songID)
+	}
+}
+
+// pinned reports whether any request is serving the files of the given song.
+func (a *songAccess) pinned(songID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pins[songID] > 0
+}
+
+// forget removes the access record of the given song.
+func (a *songAccess) forget(songID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.last, songID)
+}
+
+// pin protects the generated HLS files of the given song from removal by the
+// janitor until the returned function is called, so that a playlist or segment
+// is never removed while it is being served. The song's lock is held while
+// pinning, so the janitor either sees the pin or has already removed the files.
+func (h *Handler) pin(songID string) func() {
+	unlock := h.songLocks.lock(songID)
+	defer unlock()
+	return h.pinLocked(songID)
+}
+
+// pinLocked is pin for a caller that already holds the song's lock.
+func (h *Handler) pinLocked(songID string) func() {
+	h.songAccess.pin(songID)
+	return func() {
+		h.songAccess.touch(songID)
+		h.songAccess.unpin(songID)
+	}
+}
+
+// runJanitor periodically removes the generated HLS directories of songs that
+// have not been served for longer than SegmentTTL, until ctx is canceled.
+func (h *Handler) runJanitor(ctx context.Context) {
+	interval := h.SegmentTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.removeIdleSongs()
+		}
+	}
+}
+
+// removeIdleSongs removes the generated HLS directory of each song that has
+// been idle for longer than SegmentTTL and is not pinned. Directories of songs
+// never served since startup are judged by their modification time.
+func (h *Handler) removeIdleSongs() {
+	files, err := ioutil.ReadDir(h.TempDir)
+	if err != nil {
+		h.log().Error("HLS janitor", "error", err)
+		return
+	}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		songID := f.Name()
+		unlock := h.songLocks.lock(songID)
+		last, ok := h.songAccess.lastAccess(songID)
+		if !ok {
+			last = f.ModTime()
+		}
+		if time.Since(last) > h.SegmentTTL && !h.songAccess.pinned(songID) {
+			if err := os.RemoveAll(filepath.Join(h.TempDir, songID)); err != nil {
+				h.log().Error("HLS janitor", "error", err)
+			} else {
+				h.songAccess.forget(songID)
+			}
+		}
+		unlock()
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blockingWriter is a response writer whose first Write signals writing and
+// then waits for release to be closed.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	select {
+	case <-w.writing:
+	default:
+		close(w.writing)
+	}
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestRemoveIdleSongsDuringDownload(t *testing.T) {
+	h, _ := newTestHandler(t)
+	streamSong(t, h)
+	h.SegmentTTL = time.Nanosecond
+	songDir := filepath.Join(h.TempDir, "5")
+
+	w := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/songs/5/fileSequence0.aac", nil))
+		close(done)
+	}()
+
+	<-w.writing
+	time.Sleep(time.Millisecond)
+	h.removeIdleSongs()
+	if _, err := os.Stat(songDir); err != nil {
+		t.Fatalf("files removed while a segment was being served: %v", err)
+	}
+
+	close(w.release)
+	<-done
+	if got := w.Body.String(); got != string(segmentBody) {
+		t.Errorf("body = %q, want %q", got, segmentBody)
+	}
+	time.Sleep(time.Millisecond)
+	h.removeIdleSongs()
+	if _, err := os.Stat(songDir); !os.IsNotExist(err) {
+		t.Errorf("idle song files not removed: %v", err)
+	}
+}
+
+func TestGeneratedFilesPinnedUntilServed(t *testing.T) {
+	h, media := newTestHandler(t)
+	h.SegmentTTL = time.Nanosecond
+	songDir := filepath.Join(h.TempDir, "5")
+
+	_, unpin, err := h.segment(context.Background(), "5", filepath.Join(media, "song.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	h.removeIdleSongs()
+	if _, err := os.Stat(songDir); err != nil {
+		t.Fatalf("files removed between generation and serving: %v", err)
+	}
+
+	unpin()
+	time.Sleep(time.Millisecond)
+	h.removeIdleSongs()
+	if _, err := os.Stat(songDir); !os.IsNotExist(err) {
+		t.Errorf("idle song files not removed: %v", err)
+	}
+}
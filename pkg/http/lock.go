@@ -0,0 +1,28 @@
+package http
+
+import "sync"
+
+// songLocks serializes work on the generated HLS files of each song, so that
+// concurrent requests for the same song do not segment it more than once.
+type songLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the files of the given song and returns the function that
+// unlocks them.
+func (l *songLocks) lock(songID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[songID]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[songID] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentStreamSegmentsOnce(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := &fakeSegmenter{block: make(chan struct{})}
+	h.Segmenter = segmenter
+
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(h, "GET", "/songs/5/stream", nil).Code
+		}(i)
+	}
+
+	// Lets both requests reach the segmenter or the song's lock before the
+	// first segmentation completes.
+	for segmenter.invocations() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(segmenter.block)
+	wg.Wait()
+
+	if n := segmenter.invocations(); n != 1 {
+		t.Errorf("Segment invoked %d times, want 1", n)
+	}
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+}
+
+func TestExpiredPlaylistRegenerated(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := h.Segmenter.(*fakeSegmenter)
+	h.MaxPlaylistAge = time.Hour
+	streamSong(t, h)
+	streamSong(t, h)
+	if n := segmenter.invocations(); n != 1 {
+		t.Fatalf("Segment called %d times for a fresh playlist, want 1", n)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	playlist := filepath.Join(h.TempDir, "5", "prog_index.m3u8")
+	if err := os.Chtimes(playlist, old, old); err != nil {
+		t.Fatal(err)
+	}
+	streamSong(t, h)
+	if n := segmenter.invocations(); n != 2 {
+		t.Errorf("Segment called %d times after the playlist expired, want 2", n)
+	}
+}
+
+func TestStreamPlaylistStatError(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := h.Segmenter.(*fakeSegmenter)
+	// A file in place of the song's directory makes stating the playlist
+	// fail with an error other than not existing.
+	if err := ioutil.WriteFile(filepath.Join(h.TempDir, "5"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(h, "GET", "/songs/5/stream", nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if n := segmenter.invocations(); n != 0 {
+		t.Errorf("Segment called %d times, want 0", n)
+	}
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// StructuredLogger logs messages with fields given as alternating keys and
+// values, such as "method", "GET", so that log aggregators can index them. A
+// *slog.Logger from the standard library implements it.
+type StructuredLogger interface {
+	Info(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Log levels of the LogLevel option.
+const (
+	logLevelInfo  = "info"
+	logLevelError = "error"
+)
+
+// textLogger adapts a *log.Logger to a StructuredLogger, writing each message
+// followed by its fields in the form key=value. Informational messages are
+// dropped when errorsOnly is set.
+type textLogger struct {
+	logger     *log.Logger
+	errorsOnly bool
+}
+
+// Info logs an informational message with the given fields.
+func (t textLogger) Info(msg string, keyvals ...interface{}) {
+	if !t.errorsOnly {
+		t.logger.Print(formatFields(msg, keyvals))
+	}
+}
+
+// Error logs an error message with the given fields.
+func (t textLogger) Error(msg string, keyvals ...interface{}) {
+	t.logger.Print(formatFields(msg, keyvals))
+}
+
+// formatFields formats a message and its fields on one line. Values that
+// contain spaces, quotes, or line breaks are quoted.
+func formatFields(msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		s := fmt.Sprint(v)
+		if strings.ContainsAny(s, " \"=\n") {
+			s = strconv.Quote(s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	return b.String()
+}
+
+// log returns the StructuredLogger, or an adapter of Logger at the LogLevel
+// when none is configured.
+func (h *Handler) log() StructuredLogger {
+	if h.StructuredLogger != nil {
+		return h.StructuredLogger
+	}
+	logger := h.Logger
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return textLogger{logger: logger, errorsOnly: h.LogLevel == logLevelError}
+}
+
+// unwrapper is implemented by the response writers that wrap another, so that
+// the writers beneath can be found.
+type unwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// recordError records the error a request failed with on every statusRecorder
+// wrapped by w, so that it is logged with the request.
+func recordError(w http.ResponseWriter, err error) {
+	for w != nil {
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.err = err
+		}
+		u, ok := w.(unwrapper)
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
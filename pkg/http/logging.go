@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// statusRecorder records the status code written to a response, and the error
+// the request failed with, if any.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+// WriteHeader records the status code before writing it.
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes b to the response, recording an implicit 200 status.
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped response writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests is middleware that logs the method, path, response status code,
+// and duration of each request, with the error of a failed request, in the
+// form:
+//
+//	request method=GET path=/songs/5 status=200 duration=1.234ms
+//
+// Requests answered with a server error are logged as errors.
+func (h *Handler) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		fields := []interface{}{"method", r.Method, "path", r.URL.Path,
+			"status", rec.status, "duration", time.Since(start)}
+		if rec.err != nil {
+			fields = append(fields, "error", rec.err)
+		}
+		if rec.status >= http.StatusInternalServerError {
+			h.log().Error("request", fields...)
+		} else {
+			h.log().Info("request", fields...)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// accessLine matches a line of the access log and captures its status and
+// duration.
+var accessLine = regexp.MustCompile(`^request method=GET path=(\S+) status=(\d+) duration=(\S+)( error=.*)?$`)
+
+func TestLogRequests(t *testing.T) {
+	h, _ := newTestHandler(t)
+	var buf bytes.Buffer
+	h.Logger = log.New(&buf, "", 0)
+
+	tests := []struct {
+		path   string
+		status string
+		err    bool
+	}{
+		{"/songs/5", "200", false},
+		{"/songs/6", "404", false},
+		{"/songs/5?fail", "500", true},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		if test.err {
+			h.SongService.(*songService).err = errors.New("backend failure")
+		}
+		serve(h, "GET", test.path, nil)
+		line := strings.TrimSuffix(buf.String(), "\n")
+		m := accessLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("%s: log = %q, want an access log line", test.path, line)
+			continue
+		}
+		if m[2] != test.status {
+			t.Errorf("%s: logged status %s, want %s", test.path, m[2], test.status)
+		}
+		if d, err := time.ParseDuration(m[3]); err != nil || d <= 0 {
+			t.Errorf("%s: logged duration %q, want a positive duration", test.path, m[3])
+		}
+		if hasErr := m[4] != ""; hasErr != test.err {
+			t.Errorf("%s: log = %q, want an error logged: %v", test.path, line, test.err)
+		}
+	}
+
+	buf.Reset()
+	h.SongService.(*songService).err = nil
+	h.LogLevel = logLevelError
+	serve(h, "GET", "/songs/5", nil)
+	if buf.Len() != 0 {
+		t.Errorf("error log level: log = %q, want successful requests omitted", buf.String())
+	}
+}
+
+// logEntry is a message logged to a recordingLogger, with its fields.
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger is a StructuredLogger that records the entries logged.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Info(msg string, keyvals ...interface{}) {
+	l.record("info", msg, keyvals)
+}
+
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) {
+	l.record("error", msg, keyvals)
+}
+
+func (l *recordingLogger) record(level string, msg string, keyvals []interface{}) {
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, msg, fields})
+}
+
+func TestStructuredLogger(t *testing.T) {
+	h, _ := newTestHandler(t)
+	logger := &recordingLogger{}
+	h.StructuredLogger = logger
+	h.SongService.(*songService).err = errors.New("backend failure")
+
+	serve(h, "GET", "/songs/5", nil)
+	if len(logger.entries) != 1 {
+		t.Fatalf("entries = %+v, want one", logger.entries)
+	}
+	e := logger.entries[0]
+	if e.level != "error" || e.msg != "request" {
+		t.Errorf("entry = %s %q, want error %q", e.level, e.msg, "request")
+	}
+	if e.fields["method"] != "GET" || e.fields["path"] != "/songs/5" || fmt.Sprint(e.fields["status"]) != "500" {
+		t.Errorf("fields = %v, want method GET, path /songs/5, and status 500", e.fields)
+	}
+	if _, ok := e.fields["duration"]; !ok {
+		t.Errorf("fields = %v, want a duration", e.fields)
+	}
+	if err, ok := e.fields["error"].(error); !ok || err.Error() != "backend failure" {
+		t.Errorf("error field = %v, want the backend failure", e.fields["error"])
+	}
+}
+
+func TestFormatFields(t *testing.T) {
+	tests := []struct {
+		keyvals []interface{}
+		want    string
+	}{
+		{nil, "msg"},
+		{[]interface{}{"status", 200, "path", "/songs/5"}, "msg status=200 path=/songs/5"},
+		{[]interface{}{"error", "not found"}, `msg error="not found"`},
+		{[]interface{}{"q", `a"b`, "e", "a=b", "n", "a\nb"}, `msg q="a\"b" e="a=b" n="a\nb"`},
+		{[]interface{}{"song"}, "msg song=(missing)"},
+	}
+	for _, test := range tests {
+		if got := formatFields("msg", test.keyvals); got != test.want {
+			t.Errorf("formatFields(%v) = %q, want %q", test.keyvals, got, test.want)
+		}
+	}
+}
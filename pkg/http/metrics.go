@@ -0,0 +1,74 @@
+//go:build prometheus
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are only exposed by servers built with the prometheus build tag, so
+// that the Prometheus client library is not a dependency of other builds.
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_http_requests_total",
+		Help: "Number of HTTP requests handled, by route, method, and status code.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "server_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	segmentationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "server_hls_segmentations_total",
+		Help: "Number of times a song was segmented for HTTP Live Streaming.",
+	})
+
+	segmentationFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "server_hls_segmentation_failures_total",
+		Help: "Number of times segmenting a song failed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration,
+		segmentationsTotal, segmentationFailuresTotal)
+}
+
+// registerMetrics registers the /metrics route, which must precede the
+// catch-all route, and the middleware that instruments every request.
+func (h *Handler) registerMetrics() {
+	h.Router.Handle("/metrics", promhttp.Handler()).Methods("GET", "HEAD", "OPTIONS")
+	h.Router.Use(h.instrument)
+}
+
+// instrument is middleware that counts each request by route and status code
+// and observes its duration. Requests are labeled with the route's path
+// template rather than the path, so that IDs do not multiply the series.
+func (h *Handler) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := routeTemplate(r)
+		requestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeSegment counts a segmenter invocation that ended with the given error.
+func observeSegment(err error) {
+	segmentationsTotal.Inc()
+	if err != nil {
+		segmentationFailuresTotal.Inc()
+	}
+}
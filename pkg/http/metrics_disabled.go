@@ -0,0 +1,10 @@
+//go:build !prometheus
+
+package http
+
+// registerMetrics does nothing: metrics are only exposed by servers built with
+// the prometheus build tag.
+func (h *Handler) registerMetrics() {}
+
+// observeSegment does nothing without the prometheus build tag.
+func observeSegment(err error) {}
@@ -0,0 +1,15 @@
+//go:build !prometheus
+
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMetricsDisabled(t *testing.T) {
+	h, _ := newTestHandler(t)
+	if w := serve(h, "GET", "/metrics", nil); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build prometheus
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	h, _ := newTestHandler(t)
+	requests := requestsTotal.WithLabelValues("/songs/{id:[0-9]+}", "GET", "404")
+	before := testutil.ToFloat64(requests)
+	segmentations := testutil.ToFloat64(segmentationsTotal)
+
+	serve(h, "GET", "/songs/6", nil)
+	serve(h, "GET", "/songs/9", nil)
+	streamSong(t, h)
+
+	if got := testutil.ToFloat64(requests) - before; got != 2 {
+		t.Errorf("requests counted for the route = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(segmentationsTotal) - segmentations; got != 1 {
+		t.Errorf("segmentations counted = %v, want 1", got)
+	}
+
+	w := serve(h, "GET", "/metrics", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	want := `server_http_requests_total{method="GET",route="/songs/{id:[0-9]+}",status="404"}`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+}
+
+func TestMetricsMethods(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "POST", "/metrics", nil)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+}
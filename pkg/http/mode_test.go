@@ -0,0 +1,42 @@
+//go:build !windows
+
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeneratedFileModes(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DirMode = 0750
+	h.FileMode = 0640
+	streamSong(t, h)
+
+	tests := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"", 0750},
+		{"prog_index.m3u8", 0640},
+		{"fileSequence0.aac", 0640},
+	}
+	for _, test := range tests {
+		info, err := os.Stat(filepath.Join(h.TempDir, "5", test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != test.mode {
+			t.Errorf("%s: mode = %v, want %v", filepath.Join("5", test.name), mode, test.mode)
+		}
+	}
+
+	info, err := os.Stat(h.TempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != defaultDirMode {
+		t.Errorf("temporary directory: mode = %v, want %v", mode, defaultDirMode)
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// accepts reports whether the Accept header of the request explicitly lists
+// the given media type, either exactly or through a type/* range. A media type
+// listed with a quality of zero is treated as not accepted. The */* range is
+// ignored, so that a server default is used for clients that accept anything.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" || t == "*/*" {
+			continue
+		}
+		if t == mediaType || (strings.HasSuffix(t, "/*") &&
+			strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the request
+// lists the given content coding with a nonzero quality.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), coding) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// addVary adds the given request header names to the Vary header of the
+// response, keeping the names already listed by other handlers or middleware
+// and skipping duplicates. All handlers must use it rather than setting Vary
+// directly, so that caches see every header the response depends on.
+func addVary(h http.Header, names ...string) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, v := range append(h.Values("Vary"), names...) {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			key := http.CanonicalHeaderKey(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			fields = append(fields, key)
+		}
+	}
+	h.Set("Vary", strings.Join(fields, ", "))
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddVary(t *testing.T) {
+	h := http.Header{}
+	h.Set("Vary", "accept, Origin")
+	addVary(h, "Accept-Encoding", "origin", "")
+	if got, want := h.Get("Vary"), "Accept, Origin, Accept-Encoding"; got != want {
+		t.Errorf("Vary = %q, want %q", got, want)
+	}
+}
+
+func TestVaryCombined(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.AllowedOrigins = []string{"https://example.com"}
+
+	tests := []struct {
+		name   string
+		origin string
+	}{
+		{"allowed origin", "https://example.com"},
+		{"disallowed origin", "https://other.example.com"},
+		{"no origin", ""},
+	}
+	for _, test := range tests {
+		header := map[string]string{"Accept-Encoding": "gzip"}
+		if test.origin != "" {
+			header["Origin"] = test.origin
+		}
+		w := serve(h, "GET", "/songs/5", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", test.name, w.Code, http.StatusOK)
+		}
+		want := "Origin, Accept, Accept-Encoding"
+		if got := w.Header().Values("Vary"); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: Vary = %q, want a single %q", test.name, got, want)
+		}
+	}
+
+	h.AllowedOrigins = nil
+	w := serve(h, "GET", "/songs/5", map[string]string{"Origin": "https://example.com"})
+	if got, want := w.Header().Get("Vary"), "Accept, Accept-Encoding"; got != want {
+		t.Errorf("no allowed origins: Vary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// precompressedExts lists the extensions of generated HLS files worth storing
+// gzip-compressed. Media segments are already compressed and are left alone.
+var precompressedExts = map[string]bool{
+	".m3u8": true,
+}
+
+// precompress writes a gzip-compressed copy, with a .gz suffix, of each
+// compressible file in dir.
+func precompress(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !precompressedExts[filepath.Ext(f.Name())] {
+			continue
+		}
+		if err := gzipFile(filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gzipFile writes a gzip-compressed copy of the named file to name.gz. The
+// copy is written to a temporary file first so that a partially written copy
+// is never served.
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if _, err := io.Copy(zw, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name+".gz")
+}
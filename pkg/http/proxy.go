@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jeremybouzigard/server"
+)
+
+// defaultProxyTimeout bounds proxied requests when no timeout is configured.
+const defaultProxyTimeout = 30 * time.Second
+
+// prefixProxy reverse-proxies requests under a path prefix to an upstream.
+type prefixProxy struct {
+	prefix string
+	proxy  *httputil.ReverseProxy
+}
+
+// matches reports whether the given request path lies under the prefix, on a
+// path segment boundary, so that a prefix of /api does not match /apiary.
+func (p *prefixProxy) matches(path string) bool {
+	prefix := strings.TrimSuffix(p.prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// setProxies builds a reverse proxy for each of the ProxyTargets, ordered by
+// descending prefix length so that the most specific prefix wins.
+func (h *Handler) setProxies() error {
+	timeout := h.ProxyTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyTimeout
+	}
+	h.proxies = nil
+	for prefix, target := range h.ProxyTargets {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("proxy prefix %q must start with a slash", prefix)
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("proxy target for %s: %v", prefix, err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("proxy target for %s: %q is not an absolute HTTP URL", prefix, target)
+		}
+		h.proxies = append(h.proxies, &prefixProxy{prefix: prefix, proxy: h.newProxy(u, timeout)})
+	}
+	sort.Slice(h.proxies, func(i, j int) bool {
+		return len(h.proxies[i].prefix) > len(h.proxies[j].prefix)
+	})
+	return nil
+}
+
+// newProxy returns a reverse proxy to the given upstream. The original path
+// and query of a request are appended to the upstream URL. An upstream that
+// cannot be reached is answered with a 502, and one that does not start
+// responding within the timeout with a 504.
+func (h *Handler) newProxy(target *url.URL, timeout time.Duration) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout}).DialContext
+	transport.ResponseHeaderTimeout = timeout
+	proxy.Transport = transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		recordError(w, err)
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			handleError(w, nil, http.StatusGatewayTimeout)
+			return
+		}
+		handleError(w, nil, http.StatusBadGateway)
+	}
+	return proxy
+}
+
+// handleUnmatched handles a request no other route matched. A request to the
+// path of a route that does not support its method is answered with a 405 and
+// an Allow header listing the methods it does support. Requests under one of
+// the ProxyTargets prefixes are proxied to its upstream, and any other request
+// is answered with a 404.
+func (h *Handler) handleUnmatched(w http.ResponseWriter, r *http.Request) {
+	if allowed := h.allowedMethods(r); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed,
+			server.NewMethodNotAllowedError(r.Method, allowed))
+		return
+	}
+	for _, p := range h.proxies {
+		if p.matches(r.URL.Path) {
+			p.proxy.ServeHTTP(w, r)
+			return
+		}
+	}
+	handleNotFound(w, r)
+}
+
+// allowedMethods returns the methods of the routes whose path matches the
+// request's, whatever its method, or nil when no route's path matches.
+func (h *Handler) allowedMethods(r *http.Request) []string {
+	var allowed []string
+	seen := make(map[string]bool)
+	h.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil || len(methods) == 0 || route.GetName() == notFoundRoute {
+			return nil
+		}
+		// Matches a copy of the request with a method the route supports, so
+		// that only its path and other conditions are compared.
+		req := r.Clone(r.Context())
+		req.Method = methods[0]
+		var match mux.RouteMatch
+		if !route.Match(req, &match) {
+			return nil
+		}
+		for _, m := range methods {
+			if !seen[m] {
+				seen[m] = true
+				allowed = append(allowed, m)
+			}
+		}
+		return nil
+	})
+	return allowed
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyTargets(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	h, _ := newTestHandler(t)
+	h.ProxyTargets = map[string]string{"/podcasts": upstream.URL, "/podcasts/live": closed.URL}
+	if err := h.setProxies(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(h, "GET", "/podcasts/3/episodes?page=2", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Body.String(), "GET /podcasts/3/episodes?page=2"; got != want {
+		t.Errorf("upstream saw %q, want %q", got, want)
+	}
+
+	if w := serve(h, "GET", "/podcastsx", nil); w.Code != http.StatusNotFound {
+		t.Errorf("outside the prefix: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(h, "GET", "/songs/5", nil); w.Code != http.StatusOK {
+		t.Errorf("route: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = serve(h, "GET", "/podcasts/live/1", nil)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("unreachable upstream: status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "502" {
+		t.Errorf("unreachable upstream: errors = %+v, want one 502 error", errs)
+	}
+}
+
+func TestProxyTargetsInvalid(t *testing.T) {
+	for prefix, target := range map[string]string{
+		"podcasts":  "http://localhost:8081",
+		"/podcasts": "localhost:8081",
+	} {
+		h := NewHandler()
+		h.ProxyTargets = map[string]string{prefix: target}
+		if err := h.setProxies(); err == nil {
+			t.Errorf("%s -> %s: setProxies succeeded, want an error", prefix, target)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "POST", "/songs/5", nil)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "405" {
+		t.Errorf("errors = %+v, want one 405 error", errs)
+	}
+}
@@ -0,0 +1,384 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jeremybouzigard/server"
+)
+
+const (
+	// defaultLimit is the number of resources returned by a list endpoint when
+	// the request does not specify a limit.
+	defaultLimit = 50
+
+	// minLimit and maxLimit bound the number of resources a list endpoint
+	// returns.
+	minLimit = 1
+	maxLimit = 500
+
+	// minOffset is the smallest offset of the first resource returned.
+	minOffset = 0
+)
+
+// queryParams describes the query parameters accepted by a list endpoint, in
+// addition to the pagination parameters accepted by all of them.
+type queryParams struct {
+	// filters maps each filter parameter to its key in the queries map passed
+	// to the library services.
+	filters map[string]string
+
+	// formats maps filter parameters whose values are validated to their
+	// format. Other filters accept any string.
+	formats map[string]filterFormat
+
+	// sortable lists the fields the results can be sorted by.
+	sortable []string
+
+	// includes lists the related resources that can be included with the
+	// results.
+	includes []string
+}
+
+// pageParams are the pagination parameters accepted by every list endpoint.
+var pageParams = []string{"limit", "offset"}
+
+// filterFormat describes the format of a filter parameter's value.
+type filterFormat struct {
+	// typ is the type of the value reported by the schema.
+	typ string
+
+	// parse validates the value of the named parameter and returns it in the
+	// normalized form passed to the library services.
+	parse func(name string, value string) (string, *server.Error)
+}
+
+var (
+	// yearFormat accepts a year such as 1994.
+	yearFormat = filterFormat{typ: "integer", parse: parseYear}
+
+	// yearRangeFormat accepts an inclusive range of years such as 1990-1999.
+	yearRangeFormat = filterFormat{typ: "string", parse: parseYearRange}
+
+	// idListFormat accepts a comma-separated list of resource IDs such as
+	// 3,5,8.
+	idListFormat = filterFormat{typ: "string", parse: parseIDList}
+)
+
+var (
+	songParams = queryParams{
+		filters: map[string]string{
+			"album-id":   "albumID",
+			"artist-id":  "artistID",
+			"genre-id":   "genreID",
+			"year":       "year",
+			"year-range": "yearRange",
+			"song-id":    "songIDs"},
+		formats: map[string]filterFormat{
+			"year":       yearFormat,
+			"year-range": yearRangeFormat,
+			"song-id":    idListFormat},
+		sortable: []string{"title", "year"},
+		includes: []string{"album", "artist"}}
+
+	albumParams = queryParams{
+		filters: map[string]string{
+			"artist-id": "artistID",
+			"genre-id":  "genreID"},
+		sortable: []string{"title", "year"}}
+
+	artistParams = queryParams{
+		filters: map[string]string{
+			"genre-id": "genreID"},
+		sortable: []string{"name"}}
+)
+
+// known reports whether the named query parameter is accepted.
+func (p queryParams) known(name string) bool {
+	if _, ok := p.filters[name]; ok {
+		return true
+	}
+	if name == "sort" && len(p.sortable) > 0 {
+		return true
+	}
+	if name == "include" && len(p.includes) > 0 {
+		return true
+	}
+	for _, param := range pageParams {
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// schema describes the query parameters accepted by the endpoint. It is built
+// from the same definitions used to parse and validate them.
+func (p queryParams) schema() []server.QueryParameter {
+	var params []server.QueryParameter
+	var filters []string
+	for name := range p.filters {
+		filters = append(filters, name)
+	}
+	sort.Strings(filters)
+	for _, name := range filters {
+		typ := "string"
+		if format, ok := p.formats[name]; ok {
+			typ = format.typ
+		}
+		params = append(params, server.QueryParameter{Name: name, Kind: "filter", Type: typ})
+	}
+
+	if len(p.sortable) > 0 {
+		var values []string
+		for _, field := range p.sortable {
+			values = append(values, field, "-"+field)
+		}
+		params = append(params, server.QueryParameter{
+			Name: "sort", Kind: "sort", Type: "string", Values: values})
+	}
+
+	if len(p.includes) > 0 {
+		params = append(params, server.QueryParameter{
+			Name: "include", Kind: "include", Type: "string", Values: p.includes})
+	}
+
+	// Copies the bounds so that they can be referenced.
+	lowLimit, highLimit, lowOffset := minLimit, maxLimit, minOffset
+	params = append(params,
+		server.QueryParameter{Name: "limit", Kind: "page", Type: "integer",
+			Default: strconv.Itoa(defaultLimit), Minimum: &lowLimit, Maximum: &highLimit},
+		server.QueryParameter{Name: "offset", Kind: "page", Type: "integer",
+			Default: strconv.Itoa(minOffset), Minimum: &lowOffset})
+	return params
+}
+
+// handleGetSchema returns a handler for a request to describe the query
+// parameters accepted by an endpoint.
+func handleGetSchema(params queryParams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := server.SchemaResponse{Data: params.schema()}
+		encodeResponse(w, r, response)
+	}
+}
+
+// parseQueries parses URL values for the queries accepted by an endpoint. It
+// returns an error for each query parameter with an invalid value and, when
+// StrictQueries is set, for each query parameter the endpoint does not accept.
+// Filters absent from the request are absent from the returned queries.
+func (h *Handler) parseQueries(v url.Values, params queryParams) (map[string]string, []*server.Error) {
+	var errs []*server.Error
+	if h.StrictQueries {
+		var unknown []string
+		for name := range v {
+			if !params.known(name) {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			detail := fmt.Sprintf("%s is not a supported query parameter", name)
+			errs = append(errs, server.NewInvalidParameterError(name, detail))
+		}
+	}
+
+	queries := make(map[string]string, len(params.filters)+2)
+	for name, key := range params.filters {
+		value := v.Get(name)
+		if value == "" {
+			continue
+		}
+		if format, ok := params.formats[name]; ok {
+			var err *server.Error
+			if value, err = format.parse(name, value); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		queries[key] = value
+	}
+
+	limit, err := parseInt(v, "limit", defaultLimit, minLimit, maxLimit)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	offset, err := parseInt(v, "offset", 0, minOffset, -1)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	queries["limit"] = strconv.Itoa(limit)
+	queries["offset"] = strconv.Itoa(offset)
+
+	if field, order, err := params.parseSort(v.Get("sort")); err != nil {
+		errs = append(errs, err)
+	} else if field != "" {
+		queries["sort"] = field
+		queries["order"] = order
+	}
+	return queries, errs
+}
+
+// parseSort parses the value of a sort query parameter, a field name with an
+// optional leading "-" for descending order, into the field and the order,
+// "asc" or "desc". It returns an empty field when the value is empty, and an
+// error when the field is not sortable.
+func (p queryParams) parseSort(value string) (string, string, *server.Error) {
+	if value == "" {
+		return "", "", nil
+	}
+	field, order := value, "asc"
+	if strings.HasPrefix(value, "-") {
+		field, order = value[1:], "desc"
+	}
+	for _, sortable := range p.sortable {
+		if field == sortable {
+			return field, order, nil
+		}
+	}
+	detail := fmt.Sprintf("%s is not a sortable field; sortable fields are: %s",
+		field, strings.Join(p.sortable, ", "))
+	if len(p.sortable) == 0 {
+		detail = "these results cannot be sorted"
+	}
+	return "", "", server.NewInvalidParameterError("sort", detail)
+}
+
+// maxYear is the largest year accepted by the year filters.
+const maxYear = 9999
+
+// parseYear parses the value of the named year filter.
+func parseYear(name string, value string) (string, *server.Error) {
+	year, err := strconv.Atoi(value)
+	if err != nil || year < 0 || year > maxYear {
+		detail := fmt.Sprintf("%s must be a year from 0 to %d", name, maxYear)
+		return "", server.NewInvalidParameterError(name, detail)
+	}
+	return strconv.Itoa(year), nil
+}
+
+// parseYearRange parses the value of the named year range filter, two years
+// separated by a hyphen with the first no later than the second.
+func parseYearRange(name string, value string) (string, *server.Error) {
+	detail := fmt.Sprintf("%s must be a range of years such as 1990-1999", name)
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return "", server.NewInvalidParameterError(name, detail)
+	}
+	from, fromErr := strconv.Atoi(parts[0])
+	to, toErr := strconv.Atoi(parts[1])
+	if fromErr != nil || toErr != nil || from < 0 || to > maxYear {
+		return "", server.NewInvalidParameterError(name, detail)
+	} else if from > to {
+		detail = fmt.Sprintf("%s must not end before it starts", name)
+		return "", server.NewInvalidParameterError(name, detail)
+	}
+	return fmt.Sprintf("%d-%d", from, to), nil
+}
+
+// parseIDList parses the value of the named ID list filter, comma-separated
+// numeric IDs of which there may be at most maxLimit. Repeated IDs are
+// dropped.
+func parseIDList(name string, value string) (string, *server.Error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || strings.Trim(id, "0123456789") != "" {
+			detail := fmt.Sprintf("%s must be a comma-separated list of numeric IDs", name)
+			return "", server.NewInvalidParameterError(name, detail)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxLimit {
+		detail := fmt.Sprintf("%s must list at most %d IDs", name, maxLimit)
+		return "", server.NewInvalidParameterError(name, detail)
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// parseInclude parses the value of an include query parameter, a
+// comma-separated list of related resources, into the names of the resources
+// to include, each listed once. It returns an error naming any resource that
+// cannot be included.
+func (p queryParams) parseInclude(value string) ([]string, *server.Error) {
+	if value == "" {
+		return nil, nil
+	}
+	var names, unknown []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		known := false
+		for _, include := range p.includes {
+			known = known || name == include
+		}
+		if known {
+			names = append(names, name)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		detail := fmt.Sprintf("%s cannot be included; related resources are: %s",
+			strings.Join(unknown, ", "), strings.Join(p.includes, ", "))
+		if len(p.includes) == 0 {
+			detail = "related resources cannot be included with these results"
+		}
+		return nil, server.NewInvalidParameterError("include", detail)
+	}
+	return names, nil
+}
+
+// parseInt parses the named query parameter as an integer of at least min and,
+// unless max is negative, at most max. It returns def when the parameter is
+// absent.
+func parseInt(v url.Values, name string, def int, min int, max int) (int, *server.Error) {
+	s := v.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || (max >= 0 && n > max) {
+		detail := fmt.Sprintf("%s must be an integer of at least %d", name, min)
+		if max >= 0 {
+			detail = fmt.Sprintf("%s must be an integer from %d to %d", name, min, max)
+		}
+		return def, server.NewInvalidParameterError(name, detail)
+	}
+	return n, nil
+}
+
+// pageMeta returns the pagination metadata of a page of n resources fetched
+// from the given service with the given queries. The total is included when
+// the service implements server.Counter or server.CounterContext.
+func (h *Handler) pageMeta(ctx context.Context, service interface{}, queries map[string]string, n int) (*server.Meta, error) {
+	limit, _ := strconv.Atoi(queries["limit"])
+	offset, _ := strconv.Atoi(queries["offset"])
+	meta := &server.Meta{Limit: limit, Offset: offset}
+
+	hasNext := n >= limit
+	total, ok, err := h.count(ctx, service, queries)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		meta.Total = &total
+		hasNext = offset+n < total
+	}
+	if hasNext {
+		next := offset + n
+		meta.NextOffset = &next
+	}
+	return meta, nil
+}
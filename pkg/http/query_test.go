@@ -0,0 +1,262 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/server"
+)
+
+func TestUnknownQueryParameters(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	if w := serve(h, "GET", "/songs?ablum-id=5", nil); w.Code != http.StatusOK {
+		t.Errorf("lenient: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	h.StrictQueries = true
+	w := serve(h, "GET", "/songs?ablum-id=5&limit=10", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("strict: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	errs := decodeErrors(t, w)
+	if len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != "ablum-id" {
+		t.Errorf("strict: errors = %+v, want one error for parameter ablum-id", errs)
+	}
+}
+
+func TestMultipleInvalidParameters(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "GET", "/songs?year=abc&limit=0&offset=-1", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	errs := decodeErrors(t, w)
+	params := make(map[string]bool)
+	for _, e := range errs {
+		if e.Status != "400" || e.Source == nil {
+			t.Errorf("error = %+v, want a 400 error with a source", e)
+			continue
+		}
+		params[e.Source.Parameter] = true
+	}
+	for _, name := range []string{"year", "limit", "offset"} {
+		if !params[name] {
+			t.Errorf("errors = %+v, want one for parameter %s", errs, name)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("got %d errors, want 3", len(errs))
+	}
+}
+
+func TestInvalidPagination(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	for _, query := range []string{"limit=ten", "limit=0", "limit=501", "offset=-1", "offset=x"} {
+		w := serve(h, "GET", "/songs?"+query, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+			continue
+		}
+		name := strings.SplitN(query, "=", 2)[0]
+		if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != name {
+			t.Errorf("%s: errors = %+v, want one error for parameter %s", query, errs, name)
+		}
+	}
+}
+
+// countedSongService is a song service that can count the matching songs.
+type countedSongService struct {
+	songService
+	total int
+}
+
+func (s *countedSongService) Count(queries map[string]string) (int, error) {
+	return s.total, nil
+}
+
+func TestPaginationMeta(t *testing.T) {
+	h, _ := newTestHandler(t)
+	songs := h.SongService.(*songService)
+	serve(h, "GET", "/songs", nil)
+	if limit, offset := songs.queries["limit"], songs.queries["offset"]; limit != "50" || offset != "0" {
+		t.Errorf("default limit and offset = %q and %q, want 50 and 0", limit, offset)
+	}
+
+	tests := []struct {
+		query      string
+		service    library.SongService
+		total      *int
+		nextOffset *int
+	}{
+		{"", songs, nil, nil},
+		{"limit=1&offset=4", songs, nil, intPtr(5)},
+		{"limit=1&offset=1", &countedSongService{songService: *songs, total: 3}, intPtr(3), intPtr(2)},
+		{"limit=1&offset=2", &countedSongService{songService: *songs, total: 3}, intPtr(3), nil},
+	}
+	for _, test := range tests {
+		h.SongService = test.service
+		w := serve(h, "GET", "/songs?"+test.query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d, want %d", test.query, w.Code, http.StatusOK)
+		}
+		var response server.SongResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%q: decoding response: %v", test.query, err)
+		}
+		meta := response.Meta
+		if meta == nil {
+			t.Fatalf("%q: no meta", test.query)
+		}
+		if !equalIntPtr(meta.Total, test.total) || !equalIntPtr(meta.NextOffset, test.nextOffset) {
+			t.Errorf("%q: meta = %+v, want total %v and next offset %v",
+				test.query, meta, fmtIntPtr(test.total), fmtIntPtr(test.nextOffset))
+		}
+		if want := fmtIntPtr(test.total); test.total != nil && w.Header().Get("X-Total-Count") != want {
+			t.Errorf("%q: X-Total-Count = %q, want %q", test.query, w.Header().Get("X-Total-Count"), want)
+		}
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func equalIntPtr(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func fmtIntPtr(n *int) string {
+	if n == nil {
+		return "none"
+	}
+	return strconv.Itoa(*n)
+}
+
+func TestFilters(t *testing.T) {
+	h, _ := newTestHandler(t)
+	songs := h.SongService.(*songService)
+
+	tests := []struct {
+		query string
+		key   string
+		value string
+	}{
+		{"year=1994", "year", "1994"},
+		{"year=0042", "year", "42"},
+		{"year-range=1990-1999", "yearRange", "1990-1999"},
+		{"song-id=3,5,3", "songIDs", "3,5"},
+		{"album-id=7", "albumID", "7"},
+	}
+	for _, test := range tests {
+		if w := serve(h, "GET", "/songs?"+test.query, nil); w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", test.query, w.Code, http.StatusOK)
+		}
+		for _, key := range []string{"year", "yearRange", "songIDs", "albumID", "artistID", "genreID"} {
+			value, ok := songs.queries[key]
+			if key == test.key && value != test.value {
+				t.Errorf("%s: %s = %q, want %q", test.query, key, value, test.value)
+			} else if key != test.key && ok {
+				t.Errorf("%s: queries = %v, want no %s", test.query, songs.queries, key)
+			}
+		}
+	}
+
+	for _, query := range []string{"year=abc", "year=10000", "year-range=1999-1990", "year-range=1990", "song-id=3,x"} {
+		songs.queries = nil
+		w := serve(h, "GET", "/songs?"+query, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+			continue
+		}
+		name := strings.SplitN(query, "=", 2)[0]
+		if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != name {
+			t.Errorf("%s: errors = %+v, want one error for parameter %s", query, errs, name)
+		}
+		if songs.queries != nil {
+			t.Errorf("%s: songs were queried with %v", query, songs.queries)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	h, _ := newTestHandler(t)
+	songs := h.SongService.(*songService)
+
+	tests := []struct {
+		sort  string
+		field string
+		order string
+	}{
+		{"title", "title", "asc"},
+		{"-year", "year", "desc"},
+	}
+	for _, test := range tests {
+		if w := serve(h, "GET", "/songs?sort="+test.sort, nil); w.Code != http.StatusOK {
+			t.Fatalf("sort=%s: status = %d, want %d", test.sort, w.Code, http.StatusOK)
+		}
+		if field, order := songs.queries["sort"], songs.queries["order"]; field != test.field || order != test.order {
+			t.Errorf("sort=%s: sort and order = %q and %q, want %q and %q",
+				test.sort, field, order, test.field, test.order)
+		}
+	}
+
+	serve(h, "GET", "/songs", nil)
+	if _, ok := songs.queries["sort"]; ok {
+		t.Errorf("without sort: queries = %v, want no sort", songs.queries)
+	}
+
+	w := serve(h, "GET", "/songs?sort=-duration", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != "sort" {
+		t.Errorf("unknown field: errors = %+v, want one error for parameter sort", errs)
+	}
+}
+
+func TestSongSchema(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := serve(h, "GET", "/songs/schema", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var response server.SchemaResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding schema %q: %v", w.Body.String(), err)
+	}
+	params := make(map[string]server.QueryParameter)
+	for _, p := range response.Data {
+		params[p.Name] = p
+	}
+	if len(params) != len(songParams.filters)+4 {
+		t.Errorf("parameters = %+v, want the filters, sort, include, limit, and offset", response.Data)
+	}
+	for name := range songParams.filters {
+		if params[name].Kind != "filter" {
+			t.Errorf("%s = %+v, want a filter", name, params[name])
+		}
+	}
+	if p := params["year"]; p.Type != "integer" {
+		t.Errorf("year = %+v, want an integer", p)
+	}
+	if p := params["sort"]; p.Kind != "sort" || strings.Join(p.Values, ",") != "title,-title,year,-year" {
+		t.Errorf("sort = %+v, want the sortable fields in both orders", p)
+	}
+	if p := params["include"]; p.Kind != "include" || strings.Join(p.Values, ",") != "album,artist" {
+		t.Errorf("include = %+v, want album and artist", p)
+	}
+	limit := params["limit"]
+	if limit.Kind != "page" || limit.Default != "50" || limit.Minimum == nil || *limit.Minimum != minLimit ||
+		limit.Maximum == nil || *limit.Maximum != maxLimit {
+		t.Errorf("limit = %+v, want a page parameter from %d to %d defaulting to 50", limit, minLimit, maxLimit)
+	}
+	if offset := params["offset"]; offset.Kind != "page" || offset.Maximum != nil {
+		t.Errorf("offset = %+v, want an unbounded page parameter", offset)
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute is logged in place of a route template for requests that
+// matched no registered route.
+const unmatchedRoute = "unmatched"
+
+// recoverPanics is middleware that recovers from a panic in a handler, logs it
+// with the template of the matched route, such as /songs/{id:[0-9]+}, so that
+// panics can be grouped by route, and responds with a 500.
+func (h *Handler) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			h.log().Error("panic", "route", routeTemplate(r), "method", r.Method,
+				"path", r.URL.Path, "error", v, "stack", string(debug.Stack()))
+			handleError(w, nil, http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeTemplate returns the path template of the route matched by the request,
+// or unmatchedRoute when only the catch-all route matched.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil || route.GetName() == notFoundRoute {
+		return unmatchedRoute
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanicsLogsRoute(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler()
+	h.Logger = log.New(&buf, "", 0)
+	h.TempRoot = t.TempDir()
+	panics := func(w http.ResponseWriter, r *http.Request) { panic("handler failure") }
+	h.Router.HandleFunc("/panic/{id:[0-9]+}", panics)
+	if err := h.RegisterRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(h, "GET", "/panic/3", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Status != "500" {
+		t.Errorf("errors = %+v, want one 500 error", errs)
+	}
+	if !strings.Contains(buf.String(), "panic route=/panic/{id:[0-9]+} ") {
+		t.Errorf("log = %q, want the route template", buf.String())
+	}
+
+	buf.Reset()
+	w = httptest.NewRecorder()
+	h.recoverPanics(http.HandlerFunc(panics)).ServeHTTP(w, httptest.NewRequest("GET", "/elsewhere", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unmatched: status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(buf.String(), "panic route="+unmatchedRoute+" ") {
+		t.Errorf("unmatched: log = %q, want route=%s", buf.String(), unmatchedRoute)
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CountryResolver resolves a client IP address to an ISO 3166-1 alpha-2
+// country code, such as "US". Implementations typically wrap a geolocation
+// database.
+type CountryResolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// restrictRegion wraps a streaming handler so that clients in one of the
+// BlockedCountries receive a 451 instead of the media. All clients are allowed
+// when no CountryResolver is set or no countries are blocked.
+func (h *Handler) restrictRegion(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.regionRestricted() {
+			next(w, r)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		country, err := h.CountryResolver.Country(net.ParseIP(host))
+		if err != nil {
+			handleError(w, err, http.StatusInternalServerError)
+			return
+		}
+		for _, blocked := range h.BlockedCountries {
+			if strings.EqualFold(country, blocked) {
+				handleError(w, nil, http.StatusUnavailableForLegalReasons)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// regionRestricted reports whether streaming is restricted by region, in which
+// case whether a client receives the media depends on its address.
+func (h *Handler) regionRestricted() bool {
+	return h.CountryResolver != nil && len(h.BlockedCountries) > 0
+}
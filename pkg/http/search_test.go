@@ -0,0 +1,51 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// searchService is a server.SearchService that returns one resource of each
+// type for any term.
+type searchService struct {
+	term string
+}
+
+func (s *searchService) Search(term string) ([]*library.Song, []*library.Album, []*library.Artist, error) {
+	s.term = term
+	return []*library.Song{newSong("song.mp3")}, []*library.Album{{}}, []*library.Artist{{}}, nil
+}
+
+func TestSearch(t *testing.T) {
+	h, _ := newTestHandler(t)
+	search := &searchService{}
+	h.SearchService = search
+
+	w := serve(h, "GET", "/search?q=blue", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if search.term != "blue" {
+		t.Errorf("search term = %q, want blue", search.term)
+	}
+	var response map[string][]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding search response %q: %v", w.Body.String(), err)
+	}
+	for _, key := range []string{"songs", "albums", "artists"} {
+		if len(response[key]) != 1 {
+			t.Errorf("%s = %v, want one resource", key, response[key])
+		}
+	}
+
+	w = serve(h, "GET", "/search?q=", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("empty term: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if errs := decodeErrors(t, w); len(errs) != 1 || errs[0].Source == nil || errs[0].Source.Parameter != "q" {
+		t.Errorf("empty term: errors = %+v, want one error for parameter q", errs)
+	}
+}
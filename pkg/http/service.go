@@ -0,0 +1,208 @@
+package http
+
+import (
+	"context"
+
+	"github.com/jeremybouzigard/library"
+	"github.com/jeremybouzigard/server"
+)
+
+// The methods below call the context-aware variant of a service when it has
+// one, so that backend work ends with the request. Services that only provide
+// the original methods cannot be canceled, so they are called in the
+// background and abandoned when the context is done. Either way, each call is
+// bounded by ServiceTimeout and returns the context's error when it ends
+// first.
+
+// serviceContext returns the context of a service call made while handling a
+// request with the given context.
+func (h *Handler) serviceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if h.ServiceTimeout > 0 {
+		return context.WithTimeout(ctx, h.ServiceTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// await runs fn and returns its error, or returns the error of ctx if ctx is
+// done first. In that case fn keeps running in its goroutine until it returns,
+// and whatever it sets must not be read.
+func await(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// genres fetches all genres.
+func (h *Handler) genres(ctx context.Context) ([]*library.Genre, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.GenreService.(server.GenreContextService); ok {
+		return s.GenresContext(ctx)
+	}
+	var genres []*library.Genre
+	err := await(ctx, func() (err error) {
+		genres, err = h.GenreService.Genres()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// album fetches the album with the given ID.
+func (h *Handler) album(ctx context.Context, id string) (*library.Album, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.AlbumService.(server.AlbumContextService); ok {
+		return s.AlbumContext(ctx, id)
+	}
+	var album *library.Album
+	err := await(ctx, func() (err error) {
+		album, err = h.AlbumService.Album(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// albums fetches the albums matching the given queries.
+func (h *Handler) albums(ctx context.Context, queries map[string]string) ([]*library.Album, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.AlbumService.(server.AlbumContextService); ok {
+		return s.AlbumsContext(ctx, queries)
+	}
+	var albums []*library.Album
+	err := await(ctx, func() (err error) {
+		albums, err = h.AlbumService.Albums(queries)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// artist fetches the artist with the given ID.
+func (h *Handler) artist(ctx context.Context, id string) (*library.Artist, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.ArtistService.(server.ArtistContextService); ok {
+		return s.ArtistContext(ctx, id)
+	}
+	var artist *library.Artist
+	err := await(ctx, func() (err error) {
+		artist, err = h.ArtistService.Artist(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return artist, nil
+}
+
+// artists fetches the artists matching the given queries.
+func (h *Handler) artists(ctx context.Context, queries map[string]string) ([]*library.Artist, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.ArtistService.(server.ArtistContextService); ok {
+		return s.ArtistsContext(ctx, queries)
+	}
+	var artists []*library.Artist
+	err := await(ctx, func() (err error) {
+		artists, err = h.ArtistService.Artists(queries)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return artists, nil
+}
+
+// song fetches the song with the given ID.
+func (h *Handler) song(ctx context.Context, id string) (*library.Song, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.SongService.(server.SongContextService); ok {
+		return s.SongContext(ctx, id)
+	}
+	var song *library.Song
+	err := await(ctx, func() (err error) {
+		song, err = h.SongService.Song(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+// songs fetches the songs matching the given queries.
+func (h *Handler) songs(ctx context.Context, queries map[string]string) ([]*library.Song, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.SongService.(server.SongContextService); ok {
+		return s.SongsContext(ctx, queries)
+	}
+	var songs []*library.Song
+	err := await(ctx, func() (err error) {
+		songs, err = h.SongService.Songs(queries)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+// search fetches the songs, albums, and artists matching the given term.
+func (h *Handler) search(ctx context.Context, term string) ([]*library.Song, []*library.Album, []*library.Artist, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if s, ok := h.SearchService.(server.SearchContextService); ok {
+		return s.SearchContext(ctx, term)
+	}
+	var songs []*library.Song
+	var albums []*library.Album
+	var artists []*library.Artist
+	err := await(ctx, func() (err error) {
+		songs, albums, artists, err = h.SearchService.Search(term)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return songs, albums, artists, nil
+}
+
+// count counts the resources of the given service matching the given queries.
+// It reports false when the service cannot count them.
+func (h *Handler) count(ctx context.Context, service interface{}, queries map[string]string) (int, bool, error) {
+	ctx, cancel := h.serviceContext(ctx)
+	defer cancel()
+	if c, ok := service.(server.CounterContext); ok {
+		total, err := c.CountContext(ctx, queries)
+		return total, true, err
+	}
+	c, ok := service.(server.Counter)
+	if !ok {
+		return 0, false, nil
+	}
+	var total int
+	err := await(ctx, func() (err error) {
+		total, err = c.Count(queries)
+		return err
+	})
+	if err != nil {
+		return 0, true, err
+	}
+	return total, true, nil
+}
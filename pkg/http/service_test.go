@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// blockingSongService is a song service whose context-aware methods block
+// until their context is done, and report the context's error.
+type blockingSongService struct {
+	songService
+	started chan struct{}
+	ended   chan error
+}
+
+func newBlockingSongService() *blockingSongService {
+	return &blockingSongService{started: make(chan struct{}, 1), ended: make(chan error, 1)}
+}
+
+func (s *blockingSongService) SongContext(ctx context.Context, id string) (*library.Song, error) {
+	s.started <- struct{}{}
+	<-ctx.Done()
+	s.ended <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (s *blockingSongService) SongsContext(ctx context.Context, queries map[string]string) ([]*library.Song, error) {
+	s.started <- struct{}{}
+	<-ctx.Done()
+	s.ended <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestServiceCallCanceledWithRequest(t *testing.T) {
+	h, _ := newTestHandler(t)
+	service := newBlockingSongService()
+	h.SongService = service
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/songs/5", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	<-service.started
+	cancel()
+	select {
+	case err := <-service.ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("service context error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("service call was not canceled with the request")
+	}
+	<-done
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// slowSearchService is a server.SearchService whose Search blocks until
+// release is closed, and which cannot be canceled.
+type slowSearchService struct {
+	release chan struct{}
+}
+
+func (s *slowSearchService) Search(term string) ([]*library.Song, []*library.Album, []*library.Artist, error) {
+	<-s.release
+	return nil, nil, nil, nil
+}
+
+// countingSongService is a song service that counts songs through a
+// context-aware method that blocks until its context is done.
+type countingSongService struct {
+	songService
+	ended chan error
+}
+
+func (s *countingSongService) CountContext(ctx context.Context, queries map[string]string) (int, error) {
+	<-ctx.Done()
+	s.ended <- ctx.Err()
+	return 0, ctx.Err()
+}
+
+func TestSearchTimeout(t *testing.T) {
+	h, _ := newTestHandler(t)
+	search := &slowSearchService{release: make(chan struct{})}
+	defer close(search.release)
+	h.SearchService = search
+	h.ServiceTimeout = 10 * time.Millisecond
+
+	w := serve(h, "GET", "/search?q=blue", nil)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestCountTimeout(t *testing.T) {
+	h, _ := newTestHandler(t)
+	service := &countingSongService{songService: *h.SongService.(*songService), ended: make(chan error, 1)}
+	h.SongService = service
+	h.ServiceTimeout = 10 * time.Millisecond
+
+	w := serve(h, "GET", "/songs", nil)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if err := <-service.ended; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("count context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jeremybouzigard/server/pkg/hls"
+)
+
+// fakeTool installs an executable script with the given name and body on the
+// PATH for the duration of the test.
+func fakeTool(t *testing.T, name string, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestShutdownKillsSegmenter(t *testing.T) {
+	h, media := newTestHandler(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	fakeTool(t, "mediafilesegmenter", "echo $$ > "+pidFile+"\nexec sleep 30\n")
+	h.Segmenter = hls.MediaFileSegmenter{}
+	shutdown, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.shutdown = shutdown
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := h.segment(context.Background(), "5", filepath.Join(media, "song.mp3"))
+		done <- err
+	}()
+
+	// Waits for the segmenter to start.
+	var pid int
+	for deadline := time.Now().Add(5 * time.Second); pid == 0; {
+		if b, err := ioutil.ReadFile(pidFile); err == nil && strings.HasSuffix(string(b), "\n") {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		} else if time.Now().After(deadline) {
+			t.Fatal("segmenter did not start")
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("segment error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("segmenting was not canceled on shutdown")
+	}
+	if err := syscall.Kill(pid, 0); err != syscall.ESRCH {
+		t.Errorf("segmenter process %d still exists: %v", pid, err)
+	}
+}
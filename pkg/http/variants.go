@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jeremybouzigard/server/pkg/hls"
+)
+
+// errNoVariants is returned when adaptive-bitrate streaming is unavailable
+// because no bitrates are configured or the Segmenter cannot produce them.
+var errNoVariants = errors.New("adaptive-bitrate streaming is not available")
+
+// handleGetMasterPlaylist handles a request to get the adaptive-bitrate master
+// playlist of the song with the given ID, which references a variant playlist
+// for each bitrate of the BitrateLadder.
+func (h *Handler) handleGetMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	h.serveVariantFile(w, r, func(songID string) string {
+		return filepath.Join(h.TempDir, songID, "master.m3u8")
+	})
+}
+
+// handleGetVariantPlaylist handles a request to get the playlist of the variant
+// stream with the given bitrate of the song with the given ID.
+func (h *Handler) handleGetVariantPlaylist(w http.ResponseWriter, r *http.Request) {
+	bitrate := mux.Vars(r)["bitrate"]
+	if !h.inLadder(bitrate) {
+		handleNotFound(w, r)
+		return
+	}
+	h.serveVariantFile(w, r, func(songID string) string {
+		return filepath.Join(h.TempDir, songID, bitrate, "prog_index.m3u8")
+	})
+}
+
+// serveVariantFile generates the variant streams of the requested song, unless
+// they already exist, and serves the playlist at the path returned by path.
+func (h *Handler) serveVariantFile(w http.ResponseWriter, r *http.Request,
+	path func(songID string) string) {
+	songID := mux.Vars(r)["id"]
+	song, err := h.song(r.Context(), songID)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	} else if song == nil {
+		handleNotFound(w, r)
+		return
+	}
+	unpin, err := h.segmentVariants(r.Context(), songID, song.Attributes.FilePath)
+	if err == errNoVariants {
+		handleNotFound(w, r)
+		return
+	} else if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer unpin()
+	h.serveFile(w, r, songID, path(songID), "application/x-mpegURL")
+}
+
+// inLadder reports whether the given bitrate is one of the BitrateLadder.
+func (h *Handler) inLadder(bitrate string) bool {
+	for _, b := range h.BitrateLadder {
+		if strconv.Itoa(b) == bitrate {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentVariants generates a variant stream of the given song for each
+// bitrate of the BitrateLadder, each in a subdirectory of the song's directory
+// named after the bitrate, and a master playlist referencing them, unless they
+// already exist. The bandwidths the master playlist advertises are measured
+// from the segments of each variant once it is segmented, falling back to the
+// nominal bitrate for a variant without segments, and are kept in the master
+// playlist until the variants are generated again.
+func (h *Handler) segmentVariants(ctx context.Context, songID string, songPath string) (func(), error) {
+	vs, ok := h.Segmenter.(hls.VariantSegmenter)
+	if !ok || len(h.BitrateLadder) == 0 {
+		return nil, errNoVariants
+	}
+	songDir := filepath.Join(h.TempDir, songID)
+	masterPath := filepath.Join(songDir, "master.m3u8")
+
+	// Removes only the variant streams and the master playlist, which share
+	// the song's directory with the default stream.
+	remove := func() {
+		for _, bitrate := range h.BitrateLadder {
+			os.RemoveAll(filepath.Join(songDir, strconv.Itoa(bitrate)))
+		}
+		removeFiles(songDir, []string{"master.m3u8*"})
+	}
+	return h.ensureGenerated(songID, masterPath, remove, func() error {
+		h.mkdir(songDir)
+		ctx, cancel := h.segmentContext(ctx)
+		defer cancel()
+		var variants []hls.Variant
+		for _, bitrate := range h.BitrateLadder {
+			name := strconv.Itoa(bitrate)
+			dir := filepath.Join(songDir, name)
+			h.mkdir(dir)
+			err := vs.SegmentVariant(ctx, songPath, dir, bitrate)
+			observeSegment(err)
+			if err != nil {
+				return err
+			}
+			peak, average, err := hls.Measure(filepath.Join(dir, "prog_index.m3u8"))
+			if err != nil {
+				return err
+			} else if peak == 0 {
+				peak = bitrate
+			}
+			h.finishSegments(dir)
+			variants = append(variants, hls.Variant{
+				Bandwidth:        peak,
+				AverageBandwidth: average,
+				URI:              name + "/prog_index.m3u8"})
+		}
+		master := []byte(hls.MasterPlaylist(variants))
+		if err := ioutil.WriteFile(masterPath, master, 0600); err != nil {
+			return err
+		}
+		h.finishSegments(songDir)
+		return nil
+	})
+}
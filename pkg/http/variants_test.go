@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// variantSegmenter is an hls.VariantSegmenter that writes the same files as
+// fakeSegmenter for every variant. Segment fails with err when it is set.
+type variantSegmenter struct {
+	*fakeSegmenter
+	err error
+}
+
+func (s *variantSegmenter) Segment(ctx context.Context, songPath string, destPath string) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.fakeSegmenter.Segment(ctx, songPath, destPath)
+}
+
+func (s *variantSegmenter) SegmentVariant(ctx context.Context, songPath string, destPath string, bitrate int) error {
+	return s.fakeSegmenter.Segment(ctx, songPath, destPath)
+}
+
+// assertExist fails the test unless each of the named files of song 5 exists.
+func assertExist(t *testing.T, h *Handler, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(h.TempDir, "5", name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestStreamFailureKeepsVariants(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := &variantSegmenter{fakeSegmenter: &fakeSegmenter{}}
+	h.Segmenter = segmenter
+	h.BitrateLadder = []int{64000}
+
+	if w := serve(h, "GET", "/songs/5/master.m3u8", nil); w.Code != http.StatusOK {
+		t.Fatalf("master playlist: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	segmenter.err = errors.New("segmenter failure")
+	if w := serve(h, "GET", "/songs/5/stream", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed stream: status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	assertExist(t, h, "master.m3u8", "64000/prog_index.m3u8", "64000/fileSequence0.aac")
+	if _, err := os.Stat(filepath.Join(h.TempDir, "5", "prog_index.m3u8")); !os.IsNotExist(err) {
+		t.Errorf("partial stream playlist not removed: %v", err)
+	}
+
+	segmenter.err = nil
+	streamSong(t, h)
+	assertExist(t, h, "prog_index.m3u8", "fileSequence0.aac")
+}
+
+func TestExpiredVariantsKeepStream(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := &variantSegmenter{fakeSegmenter: &fakeSegmenter{}}
+	h.Segmenter = segmenter
+	h.BitrateLadder = []int{64000}
+	h.MaxPlaylistAge = time.Hour
+
+	streamSong(t, h)
+	if w := serve(h, "GET", "/songs/5/master.m3u8", nil); w.Code != http.StatusOK {
+		t.Fatalf("master playlist: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(h.TempDir, "5", "master.m3u8"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(h, "GET", "/songs/5/master.m3u8", nil); w.Code != http.StatusOK {
+		t.Fatalf("expired master playlist: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if n := segmenter.invocations(); n != 3 {
+		t.Errorf("segmenter called %d times, want 3", n)
+	}
+	assertExist(t, h, "prog_index.m3u8", "fileSequence0.aac", "master.m3u8", "64000/prog_index.m3u8")
+}
+
+func TestMasterPlaylistBandwidth(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Segmenter = &variantSegmenter{fakeSegmenter: &fakeSegmenter{}}
+	h.BitrateLadder = []int{64000}
+
+	w := serve(h, "GET", "/songs/5/master.m3u8", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	// The single 10 second segment of fakeSegmenter holds len(segmentBody)
+	// bytes.
+	rate := (len(segmentBody)*8 + 9) / 10
+	want := fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,", rate, rate)
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("master playlist = %q, want %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultWarmWorkers is the number of songs segmented concurrently during
+// warm-up when no number is configured.
+const defaultWarmWorkers = 2
+
+// warmUp segments each of the WarmSongIDs that has not been segmented yet,
+// with at most WarmWorkers songs at a time, so that the first requests to
+// stream them do not wait for the segmenter. It stops early when ctx is
+// canceled. Failures are logged and do not stop the warm-up.
+func (h *Handler) warmUp(ctx context.Context) {
+	workers := h.WarmWorkers
+	if workers <= 0 {
+		workers = defaultWarmWorkers
+	}
+	ids := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				h.warmSong(ctx, id)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(ids)
+	for _, id := range h.WarmSongIDs {
+		select {
+		case ids <- id:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warmSong segments the song with the given ID. It shares the song's lock with
+// requests, so a request for the song waits for the warm-up rather than
+// segmenting the song again.
+func (h *Handler) warmSong(ctx context.Context, songID string) {
+	song, err := h.song(ctx, songID)
+	if err != nil {
+		h.log().Error("HLS warm-up", "song", songID, "error", err)
+		return
+	} else if song == nil || song.Attributes == nil {
+		h.log().Error("HLS warm-up", "song", songID, "error", "song not found")
+		return
+	}
+	_, unpin, err := h.segment(ctx, songID, song.Attributes.FilePath)
+	if err != nil {
+		h.log().Error("HLS warm-up", "song", songID, "error", err)
+		return
+	}
+	unpin()
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWarmUp(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := h.Segmenter.(*fakeSegmenter)
+	h.WarmSongIDs = []string{"9", "5"}
+
+	h.warmUp(context.Background())
+	if n := segmenter.invocations(); n != 1 {
+		t.Fatalf("segmenter invoked %d times, want 1", n)
+	}
+	if _, err := os.Stat(filepath.Join(h.TempDir, "5", "prog_index.m3u8")); err != nil {
+		t.Errorf("warmed song's playlist: %v", err)
+	}
+	if h.songAccess.pinned("5") {
+		t.Error("warmed song left pinned")
+	}
+
+	streamSong(t, h)
+	if n := segmenter.invocations(); n != 1 {
+		t.Errorf("segmenter invoked %d times after streaming a warmed song, want 1", n)
+	}
+}
+
+func TestStart(t *testing.T) {
+	h, _ := newTestHandler(t)
+	segmenter := h.Segmenter.(*fakeSegmenter)
+	segmenter.block = make(chan struct{})
+	h.WarmSongIDs = []string{"5"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.Start(ctx)
+	for deadline := time.Now().Add(5 * time.Second); segmenter.invocations() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("warm-up did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	unlocked := make(chan struct{})
+	go func() {
+		h.songLocks.lock("5")()
+		close(unlocked)
+	}()
+	select {
+	case <-unlocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warm-up was not canceled")
+	}
+	if _, err := os.Stat(filepath.Join(h.TempDir, "5", "prog_index.m3u8")); !os.IsNotExist(err) {
+		t.Errorf("canceled warm-up left a playlist: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package lyrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// Lyrics holds the lyrics of a song as plain text and, when available, in the
+// LRC format, in which each line is prefixed by the time it is sung.
+type Lyrics struct {
+	Plain string
+	LRC   string
+}
+
+// Source provides the lyrics associated with a song.
+type Source interface {
+	// Lyrics returns the lyrics of the given song, or nil if it has none.
+	Lyrics(song *library.Song) (*Lyrics, error)
+}
+
+// SidecarSource reads lyrics from files stored next to the song file with the
+// same base name: an .lrc file for timestamped lyrics and a .txt file for plain
+// lyrics. When only an .lrc file exists, the plain lyrics are derived from it.
+type SidecarSource struct{}
+
+// Lyrics reads the sidecar lyrics files of the given song. A song without a
+// file has no lyrics.
+func (SidecarSource) Lyrics(song *library.Song) (*Lyrics, error) {
+	if song == nil || song.Attributes == nil || song.Attributes.FilePath == "" {
+		return nil, nil
+	}
+	base := strings.TrimSuffix(song.Attributes.FilePath, filepath.Ext(song.Attributes.FilePath))
+	lrc, err := readOptional(base + ".lrc")
+	if err != nil {
+		return nil, err
+	}
+	plain, err := readOptional(base + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	if lrc == "" && plain == "" {
+		return nil, nil
+	}
+	if lrc != "" {
+		if err := ValidateLRC(lrc); err != nil {
+			return nil, err
+		}
+		if plain == "" {
+			plain = StripTimestamps(lrc)
+		}
+	}
+	return &Lyrics{Plain: plain, LRC: lrc}, nil
+}
+
+// readOptional returns the contents of the named file, or an empty string if
+// the file does not exist.
+func readOptional(name string) (string, error) {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(b), err
+}
+
+var (
+	// timeTag matches an LRC time tag such as [01:23.45].
+	timeTag = regexp.MustCompile(`^\[\d{2,}:[0-5]\d(?:[.:]\d{2,3})?\]`)
+	// idTag matches an LRC metadata tag such as [ar:Artist].
+	idTag = regexp.MustCompile(`^\[[A-Za-z#]+:[^\]]*\]$`)
+)
+
+// ValidateLRC checks that every non-empty line of lrc is either a metadata tag
+// or begins with at least one well-formed time tag.
+func ValidateLRC(lrc string) error {
+	for i, line := range strings.Split(lrc, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || timeTag.MatchString(line) || idTag.MatchString(line) {
+			continue
+		}
+		return fmt.Errorf("lyrics: invalid LRC timestamp on line %d", i+1)
+	}
+	return nil
+}
+
+// StripTimestamps converts LRC lyrics to plain text by removing time tags and
+// dropping metadata tags.
+func StripTimestamps(lrc string) string {
+	var lines []string
+	for _, line := range strings.Split(lrc, "\n") {
+		line = strings.TrimSpace(line)
+		if idTag.MatchString(line) {
+			continue
+		}
+		for timeTag.MatchString(line) {
+			line = timeTag.ReplaceAllString(line, "")
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
@@ -0,0 +1,85 @@
+package lyrics
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeremybouzigard/library"
+)
+
+// newSong returns a song whose file is at the given path. The attributes are
+// set through reflection so that the test does not depend on the name of the
+// library's attributes type.
+func newSong(path string) *library.Song {
+	song := &library.Song{}
+	v := reflect.ValueOf(song).Elem().FieldByName("Attributes")
+	attrs := reflect.New(v.Type().Elem())
+	attrs.Elem().FieldByName("FilePath").SetString(path)
+	v.Set(attrs)
+	return song
+}
+
+const testLRC = "[ar:Artist]\n[00:01.00]First line\n[00:05.50][01:05.50]Chorus\n"
+
+func TestValidateLRC(t *testing.T) {
+	tests := []struct {
+		lrc   string
+		valid bool
+	}{
+		{testLRC, true},
+		{"", true},
+		{"[00:01]No fraction\n", true},
+		{"No timestamp\n", false},
+		{"[0:01.00]Short minutes\n", false},
+		{"[00:61.00]Bad seconds\n", false},
+	}
+	for _, test := range tests {
+		if err := ValidateLRC(test.lrc); (err == nil) != test.valid {
+			t.Errorf("ValidateLRC(%q) = %v, want valid %v", test.lrc, err, test.valid)
+		}
+	}
+}
+
+func TestStripTimestamps(t *testing.T) {
+	want := "First line\nChorus\n"
+	if got := StripTimestamps(testLRC); got != want {
+		t.Errorf("StripTimestamps = %q, want %q", got, want)
+	}
+}
+
+func TestSidecarSource(t *testing.T) {
+	dir := t.TempDir()
+	song := newSong(filepath.Join(dir, "song.mp3"))
+
+	l, err := SidecarSource{}.Lyrics(song)
+	if err != nil || l != nil {
+		t.Fatalf("without sidecar files: Lyrics = %v, %v, want nil, nil", l, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "song.lrc"), []byte(testLRC), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err = SidecarSource{}.Lyrics(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.LRC != testLRC || l.Plain != "First line\nChorus\n" {
+		t.Errorf("Lyrics = %+v, want the LRC lyrics and their plain text", l)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "song.lrc"), []byte("not LRC\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (SidecarSource{}).Lyrics(song); err == nil {
+		t.Error("invalid LRC file: Lyrics returned no error")
+	}
+}
+
+func TestSidecarSourceWithoutAttributes(t *testing.T) {
+	l, err := SidecarSource{}.Lyrics(&library.Song{})
+	if err != nil || l != nil {
+		t.Errorf("Lyrics = %v, %v, want nil, nil", l, err)
+	}
+}
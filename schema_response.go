@@ -0,0 +1,22 @@
+package server
+
+// SchemaResponse describes the query parameters supported by a list endpoint,
+// so that clients can discover its filtering, sorting, and pagination
+// capabilities.
+type SchemaResponse struct {
+	Data []QueryParameter `json:"data"`
+}
+
+// QueryParameter describes a query parameter. Kind is one of "filter",
+// "sort", "include", or "page", and Type is the type of its value, "string"
+// or "integer". Values lists the allowed values when only some are allowed,
+// and Minimum and Maximum bound integer values.
+type QueryParameter struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Type    string   `json:"type"`
+	Values  []string `json:"values,omitempty"`
+	Default string   `json:"default,omitempty"`
+	Minimum *int     `json:"minimum,omitempty"`
+	Maximum *int     `json:"maximum,omitempty"`
+}
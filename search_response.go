@@ -0,0 +1,19 @@
+package server
+
+import (
+	"github.com/jeremybouzigard/library"
+)
+
+// SearchResponse represents the resource objects of each type that match the
+// term of a search request.
+type SearchResponse struct {
+	Songs   []*library.Song   `json:"songs"`
+	Albums  []*library.Album  `json:"albums"`
+	Artists []*library.Artist `json:"artists"`
+}
+
+// SearchService searches the library for songs, albums, and artists matching a
+// term.
+type SearchService interface {
+	Search(term string) ([]*library.Song, []*library.Album, []*library.Artist, error)
+}
@@ -7,5 +7,7 @@ import (
 // SongResponse represents the primary data provided in the response to a
 // successful request to fetch a song resource object.
 type SongResponse struct {
-	Data []*library.Song `json:"data,omitempty"`
+	Data     []*library.Song `json:"data,omitempty"`
+	Meta     *Meta           `json:"meta,omitempty"`
+	Included *Included       `json:"included,omitempty"`
 }